@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"regexp"
+	"sync"
+)
+
+// chaosRate is the share of records (0 to 1) deliberately corrupted before they are written,
+// to test how parsers and ingestion pipelines cope with bad input. Testing only: corrupted
+// records are meant to be rejected downstream, so never enable it where the logs matter
+var chaosRate = 0.0
+
+// Ways a record can be corrupted by -chaos-rate
+const (
+	chaosTruncate    = iota // Cut the record short, e.g. JSON missing its closing brace
+	chaosWrongType          // Quote a number, e.g. "status_code":"500" (JSON and ECS only)
+	chaosControlChar        // Insert a raw control character the format should have escaped
+)
+
+var (
+	chaosMu  sync.Mutex
+	chaosRNG *rand.Rand // Seeded from -seed in main, so corrupted records are reproducible
+)
+
+// jsonNumber matches the first numeric field of a JSON record
+var jsonNumber = regexp.MustCompile(`":(-?[0-9]+)`)
+
+// chaos returns line unchanged or, for a chaosRate share of records, a corrupted copy
+func chaos(line []byte) []byte {
+	if chaosRate <= 0 || chaosRNG == nil {
+		return line
+	}
+	chaosMu.Lock()
+	defer chaosMu.Unlock()
+	if chaosRNG.Float64() >= chaosRate || len(line) < 2 {
+		return line
+	}
+	logChaosRecords.Add(1)
+
+	kind := chaosRNG.Intn(3)
+	if kind == chaosWrongType && line[0] != '{' {
+		kind = chaosTruncate // Text formats have no types to get wrong
+	}
+	switch kind {
+	case chaosWrongType:
+		if loc := jsonNumber.FindSubmatchIndex(line); loc != nil {
+			var out bytes.Buffer
+			out.Write(line[:loc[2]])
+			out.WriteByte('"')
+			out.Write(line[loc[2]:loc[3]])
+			out.WriteByte('"')
+			out.Write(line[loc[3]:])
+			return out.Bytes()
+		}
+		fallthrough
+	case chaosTruncate:
+		return append([]byte(nil), line[:1+chaosRNG.Intn(len(line)-1)]...)
+	default:
+		at := 1 + chaosRNG.Intn(len(line)-1)
+		out := make([]byte, 0, len(line)+1)
+		out = append(out, line[:at]...)
+		out = append(out, byte(1+chaosRNG.Intn(8))) // SOH to BS: never a delimiter or tab
+		return append(out, line[at:]...)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// Clock is the source of time for timestamps, rotation and pacing, so tests can fake it
+type Clock interface {
+	Now() time.Time
+	// Sleep waits for d, returning false if ctx is done first
+	Sleep(ctx context.Context, d time.Duration) bool
+}
+
+// realClock is the wall clock
+type realClock struct{}
+
+// Now implements Clock
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// Sleep implements Clock
+func (realClock) Sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,490 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported destinations for log entries
+const (
+	outputFile   = "file"   // Write to logFile with rotation (default)
+	outputStdout = "stdout" // Write to stdout for the container runtime to collect
+	outputHTTP   = "http"   // POST batches directly to an ingestion API such as middleware.io
+	outputOTLP   = "otlp"   // Export batches over OTLP/HTTP to an OpenTelemetry collector or backend
+)
+
+// logOutput selects the Sink each entry is sent to, or a comma-separated list of them to
+// write every entry to all of them
+var logOutput = outputFile
+
+// outputs returns the outputs named in logOutput
+func outputs() []string {
+	return strings.Split(logOutput, ",")
+}
+
+// hasOutput reports whether logOutput includes name
+func hasOutput(name string) bool {
+	for _, o := range outputs() {
+		if o == name {
+			return true
+		}
+	}
+	return false
+}
+
+// validOutputs reports the first problem with a comma-separated list of outputs, if any
+func validOutputs(list string) error {
+	seen := map[string]bool{}
+	for _, o := range strings.Split(list, ",") {
+		if o != outputFile && o != outputStdout && o != outputHTTP && o != outputOTLP {
+			return fmt.Errorf("%q is not file, stdout, http or otlp", o)
+		}
+		if seen[o] {
+			return fmt.Errorf("%s is listed twice", o)
+		}
+		seen[o] = true
+	}
+	return nil
+}
+
+// compressStdout gzips the stdout stream, for piping it to a collector over a constrained link
+var compressStdout = false
+
+// dryRun prints generated entries to stderr instead of writing or rotating anything
+var dryRun = false
+
+// seedDataFile optionally points at a JSON file replacing the built-in sample users, endpoints, etc.
+var seedDataFile = ""
+
+// schemaFile optionally points at a JSON Schema every generated entry is validated against
+var schemaFile = ""
+
+// verifyOnly checks rotated files against their .meta sidecars and exits instead of generating logs
+var verifyOnly = false
+
+// printParserOnly prints a matching Fluent Bit parser stanza and exits instead of generating logs
+var printParserOnly = false
+
+// metricsAddr is the listen address of the Prometheus metrics endpoint (empty disables it)
+var metricsAddr = ""
+
+// Configuration is resolved in increasing order of precedence:
+//  1. the built-in defaults declared alongside the package variables
+//  2. environment variables, applied by loadConfig
+//  3. command-line flags, applied by parseFlags
+//
+// loadConfig must therefore run before parseFlags so that the flag defaults
+// already reflect any environment overrides.
+
+// loadConfig applies LOG_FILE, LOG_MAX_SIZE_BYTES, LOG_MAX_FILES, LOG_COMPRESS_ROTATED,
+// LOG_STRICT_SIZE, LOG_ROTATE_INTERVAL, LOG_ROTATE_NAMING, LOG_MAX_AGE, LOG_FORMAT, LOG_OUTPUT,
+// MW_API_KEY, METRICS_ADDR, HEALTH_ADDR, APP_ENV and APP_VERSION over the defaults.
+// Invalid values are reported and ignored so a bad deployment manifest doesn't crash the service
+func loadConfig() {
+	if v, ok := os.LookupEnv("LOG_FILE"); ok && v != "" {
+		logFile = v
+	}
+	if v, ok := os.LookupEnv("LOG_MAX_SIZE_BYTES"); ok {
+		size, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || size <= 0 {
+			log.Printf("ignoring LOG_MAX_SIZE_BYTES=%q: must be a positive integer, using default %d", v, maxSize)
+		} else {
+			maxSize = size
+		}
+	}
+	if v, ok := os.LookupEnv("LOG_MAX_FILES"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Printf("ignoring LOG_MAX_FILES=%q: must be a positive integer, using default %d", v, maxFiles)
+		} else {
+			maxFiles = n
+		}
+	}
+	if v, ok := os.LookupEnv("LOG_COMPRESS_ROTATED"); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Printf("ignoring LOG_COMPRESS_ROTATED=%q: must be a boolean, using default %t", v, compressRotated)
+		} else {
+			compressRotated = b
+		}
+	}
+	if v, ok := os.LookupEnv("LOG_STRICT_SIZE"); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Printf("ignoring LOG_STRICT_SIZE=%q: must be a boolean, using default %t", v, strictSize)
+		} else {
+			strictSize = b
+		}
+	}
+	if v, ok := os.LookupEnv("LOG_ROTATE_INTERVAL"); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			log.Printf("ignoring LOG_ROTATE_INTERVAL=%q: must be a non-negative duration such as 24h, using default %s", v, rotateInterval)
+		} else {
+			rotateInterval = d
+		}
+	}
+	if v, ok := os.LookupEnv("LOG_ROTATE_NAMING"); ok {
+		if v != namingNumbered && v != namingDated {
+			log.Printf("ignoring LOG_ROTATE_NAMING=%q: must be numbered or dated, using default %s", v, rotateNaming)
+		} else {
+			rotateNaming = v
+		}
+	}
+	if v, ok := os.LookupEnv("LOG_MAX_AGE"); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			log.Printf("ignoring LOG_MAX_AGE=%q: must be a non-negative duration such as 168h, using default %s", v, maxAge)
+		} else {
+			maxAge = d
+		}
+	}
+	if v, ok := os.LookupEnv("LOG_FORMAT"); ok {
+		if !validFormat(v) {
+			log.Printf("ignoring LOG_FORMAT=%q: must be one of json, json-array, logfmt, plain, syslog or ecs, using default %s", v, logFormat)
+		} else {
+			logFormat = v
+		}
+	}
+	if v, ok := os.LookupEnv("LOG_OUTPUT"); ok {
+		if err := validOutputs(v); err != nil {
+			log.Printf("ignoring LOG_OUTPUT=%q: %v, using default %s", v, err, logOutput)
+		} else {
+			logOutput = v
+		}
+	}
+	if v, ok := os.LookupEnv("MW_API_KEY"); ok {
+		httpAPIKey = v
+	}
+	// The standard OpenTelemetry exporter variables; the logs-specific ones win
+	if v, ok := os.LookupEnv("OTEL_EXPORTER_OTLP_ENDPOINT"); ok && v != "" {
+		otlpEndpoint = strings.TrimSuffix(v, "/") + "/v1/logs"
+	}
+	if v, ok := os.LookupEnv("OTEL_EXPORTER_OTLP_LOGS_ENDPOINT"); ok && v != "" {
+		otlpEndpoint = v
+	}
+	for _, name := range []string{"OTEL_EXPORTER_OTLP_HEADERS", "OTEL_EXPORTER_OTLP_LOGS_HEADERS"} {
+		if v, ok := os.LookupEnv(name); ok {
+			if err := otlpHeaders.Set(v); err != nil {
+				log.Printf("ignoring %s: %v", name, err)
+			}
+		}
+	}
+	if v, ok := os.LookupEnv("METRICS_ADDR"); ok {
+		metricsAddr = v
+	}
+	if v, ok := os.LookupEnv("HEALTH_ADDR"); ok {
+		healthAddr = v
+	}
+	if v, ok := os.LookupEnv("APP_ENV"); ok && v != "" {
+		appEnv = v
+	}
+	if v, ok := os.LookupEnv("APP_VERSION"); ok {
+		appVersion = v
+	}
+}
+
+// parseFlags overrides the rotation defaults with command-line flags and validates them,
+// so the generator can be pointed at a different path or tuned without rebuilding
+func parseFlags() {
+	maxSizeMB := flag.Int64("max-size-mb", 0, "rotate the log file once it exceeds this many megabytes (default from LOG_MAX_SIZE_BYTES or 10)")
+	flag.StringVar(&logFile, "log-file", logFile, "path of the log file to write")
+	flag.Var(&fsyncMode, "fsync", "when to fsync the log file: off, always (after every entry) or interval=DURATION, e.g. interval=5s")
+	flag.Var(&logFileMode, "file-mode", "octal permissions for created log files, rotated and compressed ones included, e.g. 0600 or 0640")
+	flag.Var(&logDirMode, "log-dir-mode", "octal permissions for the log file's directory if it has to be created")
+	flag.IntVar(&maxFiles, "max-files", maxFiles, "number of rotated log files to retain")
+	flag.DurationVar(&rotateInterval, "rotate-interval", rotateInterval, "also rotate once the log file is older than this, e.g. 24h (0 disables)")
+	flag.StringVar(&rotateNaming, "rotate-naming", rotateNaming, "how rotated files are named: numbered (app.log.1) or dated (app-2024-06-01.log, rotated at UTC midnight)")
+	flag.BoolVar(&truncateOnStart, "truncate-on-start", truncateOnStart, "empty the log file at startup instead of appending to the previous run's entries")
+	flag.BoolVar(&cleanStart, "clean-start", cleanStart, "like -truncate-on-start, and also remove the rotated files left by previous runs")
+	flag.BoolVar(&externalRotation, "external-rotation", externalRotation, "leave rotation to an external tool such as logrotate, reopening the log file on SIGHUP")
+	flag.DurationVar(&rotateJitter, "rotate-jitter", rotateJitter, "offset time-based rotation by a random amount within ±this, fixed per instance, e.g. 5m (0 disables)")
+	flag.DurationVar(&maxAge, "max-age", maxAge, "with -rotate-naming=dated, also remove rotated files older than this, e.g. 168h (0 keeps -max-files of them)")
+	flag.Var(&maxTotalSize, "max-total-size", "also remove the oldest rotated files once together they take up more than this, e.g. 500MB or 2GB (0 disables)")
+	flag.BoolVar(&compressRotated, "compress-rotated", compressRotated, "gzip rotated log files (app.log.1.gz, ...)")
+	flag.DurationVar(&flushInterval, "flush-interval", flushInterval, "flush buffered entries to the output at least this often, trading latency for fewer write syscalls")
+	flag.StringVar(&redactFields, "redact-fields", redactFields, "comma-separated fields to redact before writing, by JSON name, e.g. user_id,hostname,attributes.tenant_id")
+	flag.StringVar(&redactStrategy, "redact-strategy", redactStrategy, "how to redact -redact-fields: mask (replace with ***) or hash (a short SHA-256 digest)")
+	flag.BoolVar(&compressStdout, "compress-stdout", compressStdout, "gzip the stdout stream, flushed every second so the consumer can decompress as it goes (requires -output=stdout)")
+	flag.BoolVar(&splitByService, "split-by-service", splitByService, "write each service's entries to its own <service>.log, rotated independently, in the -log-file directory")
+	flag.BoolVar(&recordMeta, "rotation-meta", recordMeta, "write an app.log.N.meta sidecar with the line count and SHA-256 of each rotated file")
+	flag.BoolVar(&verifyOnly, "verify", verifyOnly, "check rotated log files against their .meta sidecars, then exit (non-zero on mismatch)")
+	flag.BoolVar(&strictSize, "strict-size", strictSize, "rotate before a write would push the log file past the size limit, so no file exceeds it")
+	flag.StringVar(&logFormat, "format", logFormat, "output format for log entries: json, json-array, logfmt, plain, syslog or ecs")
+	flag.StringVar(&delimiter, "delimiter", delimiter, "record delimiter written after each entry: newline, null or crlf (ignored for json-array)")
+	flag.IntVar(&maxLineBytes, "max-line-bytes", maxLineBytes, "shorten the stack trace, then the message, of entries serializing to more than this many bytes, marking them truncated (0 disables)")
+	flag.StringVar(&fieldCase, "field-case", fieldCase, "spelling of field names in json, json-array, logfmt, plain and syslog output: snake (response_time_ms) or camel (responseTimeMs)")
+	flag.StringVar(&timestampFormat, "timestamp-format", timestampFormat, "timestamp encoding: rfc3339, rfc3339nano, epoch_ms or epoch_ns")
+	flag.StringVar(&logOutput, "output", logOutput, "where to write log entries: file (with rotation), stdout, http or otlp, or a comma-separated list such as file,stdout to write to several")
+	flag.StringVar(&httpEndpoint, "http-endpoint", httpEndpoint, "URL to POST log batches to with -output=http")
+	flag.StringVar(&httpAPIKey, "http-api-key", httpAPIKey, "API key sent with every HTTP batch (default from MW_API_KEY)")
+	flag.StringVar(&httpAPIKeyHeader, "http-api-key-header", httpAPIKeyHeader, "header carrying the API key")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", otlpEndpoint, "OTLP/HTTP logs URL to export to with -output=otlp")
+	flag.Var(&otlpHeaders, "otlp-headers", "comma-separated key=value headers sent with every OTLP export, e.g. authorization=<key>")
+	flag.IntVar(&httpBatchSize, "http-batch-size", httpBatchSize, "send a batch once this many entries are pending (http and otlp)")
+	flag.DurationVar(&httpFlushInterval, "http-flush-interval", httpFlushInterval, "send pending entries at least this often")
+	flag.IntVar(&httpMaxRetries, "http-max-retries", httpMaxRetries, "retries per batch on network errors and 5xx responses")
+	flag.Float64Var(&rate, "rate", rate, "target log entries per second (default: a random 1-3s pause between iterations)")
+	flag.IntVar(&burstSize, "burst", burstSize, "emit this many entries back-to-back, then pause for -burst-pause (0 disables)")
+	flag.DurationVar(&burstPause, "burst-pause", burstPause, "pause between bursts in burst mode")
+	flag.StringVar(&seedDataFile, "seed-data", seedDataFile, "JSON file with users, endpoints, regions, components and services to sample from")
+	flag.StringVar(&scenarioFile, "scenario", scenarioFile, "YAML file with a whole generation profile (rate, level weights, region, incidents, endpoints, ...); flags given here override it")
+	flag.StringVar(&schemaFile, "schema", schemaFile, "JSON Schema file to validate each generated entry against; mismatches are logged and counted")
+	flag.BoolVar(&printParserOnly, "print-parser", printParserOnly, "print a Fluent Bit [PARSER] stanza matching -format and -timestamp-format, then exit")
+	flag.BoolVar(&dryRun, "dry-run", dryRun, "print generated entries to stderr without writing or rotating any file")
+	flag.StringVar(&latencyDist, "latency-dist", latencyDist, "response-time distribution: uniform, lognormal or bimodal")
+	flag.DurationVar(&incidentEvery, "incident-every", incidentEvery, "simulate an incident on this schedule, e.g. 15m (0 only starts one on SIGUSR1)")
+	flag.DurationVar(&incidentDuration, "incident-duration", incidentDuration, "how long each simulated incident raises the error rate to about 80%")
+	flag.StringVar(&region, "region", region, "region every entry comes from, e.g. eu-west-1, to simulate one deployment (random picks one per entry)")
+	flag.StringVar(&appEnv, "env", appEnv, "deployment stage attached to every entry as env, e.g. dev, staging or prod")
+	flag.StringVar(&appVersion, "version", appVersion, "service version attached to every entry as service_version (empty omits it)")
+	flag.DurationVar(&selfMetricsInterval, "self-metrics-interval", selfMetricsInterval, "log the generator's own goroutine count and heap usage as self-monitor entries this often, e.g. 30s (0 disables)")
+	flag.BoolVar(&countByLevel, "count-by-level", countByLevel, "on shutdown, print the number of entries written per level and the rotations to stderr")
+	flag.DurationVar(&heartbeatInterval, "heartbeat-interval", heartbeatInterval, "write an INFO heartbeat entry with an increasing sequence field this often, e.g. 10s (0 disables)")
+	flag.DurationVar(&dedupWindow, "dedup-window", dedupWindow, "collapse identical consecutive entries (same level and message) within this window into one with repeat_count, e.g. 10s (0 disables)")
+	flag.BoolVar(&includeCaller, "include-caller", includeCaller, "add file and line fields with the source location that emitted each entry (adds runtime.Caller overhead)")
+	flag.Var(&levelWeights, "level-weights", "relative weights of component health log levels, e.g. ERROR=40,WARN=20,INFO=40")
+	flag.Var(&sampleRates, "sample", "keep only 1 in N entries of a level, e.g. INFO=10 (other levels are always kept)")
+	flag.StringVar(&replayFile, "replay", replayFile, "re-emit the entries of this JSON lines log file, keeping their relative spacing, instead of generating new ones")
+	flag.Float64Var(&replaySpeed, "replay-speed", replaySpeed, "time scale for -replay, e.g. 10 replays ten times faster")
+	flag.IntVar(&queueSize, "queue-size", queueSize, "buffer up to this many entries between generation and writing (0 writes inline)")
+	flag.StringVar(&queuePolicy, "queue-policy", queuePolicy, "what generation does when the queue is full: block or drop-oldest")
+	flag.IntVar(&workers, "workers", workers, "number of concurrent generator goroutines; -rate and -burst apply to their combined output")
+	flag.Int64Var(&seed, "seed", seed, "seed for the random source, making the generated sequence reproducible (default: time-based)")
+	minLevelName := flag.String("min-level", string(minLevel), "drop entries below this level: "+levelNames(levels))
+	flag.DurationVar(&runDuration, "duration", runDuration, "stop after running for this long, e.g. 30s (0 runs forever)")
+	flag.Int64Var(&maxEntries, "max-entries", maxEntries, "stop after writing this many entries (0 means unlimited)")
+	flag.Float64Var(&chaosRate, "chaos-rate", chaosRate, "TESTING ONLY: share of records (0-1) to corrupt on purpose by truncating them, quoting a number or adding a raw control character")
+	flag.IntVar(&minErrorsPerMinute, "min-errors-per-minute", minErrorsPerMinute, "inject component failures whenever fewer than this many ERROR entries were written in the minute so far, so alert tests always have data (0 disables)")
+	flag.BoolVar(&once, "once", once, "write a single entry from one generation pass and exit, seeded for a repeatable entry unless -seed is given")
+	flag.BoolVar(&fallbackStdout, "fallback-stdout", fallbackStdout, "switch to writing to stdout once -max-write-failures writes to the log file in a row have failed, instead of exiting")
+	flag.IntVar(&maxWriteFailures, "max-write-failures", maxWriteFailures, "exit after this many consecutive failed writes (0 never gives up)")
+	flag.StringVar(&metricsAddr, "metrics-addr", metricsAddr, "listen address for the Prometheus /metrics endpoint, e.g. :9100 (empty disables)")
+	flag.StringVar(&healthAddr, "health-addr", healthAddr, "listen address for the /healthz and /readyz probes, e.g. :8080 (empty disables; may equal -metrics-addr)")
+	flag.DurationVar(&healthStaleAfter, "health-stale-after", healthStaleAfter, "report unhealthy on /healthz once no entry has been written for this long")
+	flag.Parse()
+
+	// A scenario fills in the flags that were not given, so its values are validated like theirs below
+	if scenarioFile != "" {
+		if err := applyScenario(scenarioFile); err != nil {
+			log.Fatalf("invalid -scenario: %v", err)
+		}
+	}
+
+	// Only override the size when the flag was given explicitly, so a byte-exact
+	// LOG_MAX_SIZE_BYTES isn't rounded down to whole megabytes
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "max-size-mb":
+			if *maxSizeMB <= 0 {
+				log.Fatalf("invalid -max-size-mb %d: must be greater than zero", *maxSizeMB)
+			}
+			maxSize = *maxSizeMB * 1024 * 1024
+		case "seed":
+			seedSet = true
+		case "rate":
+			if rate <= 0 {
+				log.Fatalf("invalid -rate %g: must be greater than zero", rate)
+			}
+		}
+	})
+
+	// Reject counts and paths that would make rotation meaningless
+	if maxFiles <= 0 {
+		log.Fatalf("invalid -max-files %d: must be greater than zero", maxFiles)
+	}
+	if rotateInterval < 0 {
+		log.Fatalf("invalid -rotate-interval %s: must not be negative", rotateInterval)
+	}
+	if heartbeatInterval < 0 {
+		log.Fatalf("invalid -heartbeat-interval %s: must not be negative", heartbeatInterval)
+	}
+	if selfMetricsInterval < 0 {
+		log.Fatalf("invalid -self-metrics-interval %s: must not be negative", selfMetricsInterval)
+	}
+	if dedupWindow < 0 {
+		log.Fatalf("invalid -dedup-window %s: must not be negative", dedupWindow)
+	}
+	if incidentEvery < 0 {
+		log.Fatalf("invalid -incident-every %s: must not be negative", incidentEvery)
+	}
+	if incidentDuration <= 0 {
+		log.Fatalf("invalid -incident-duration %s: must be greater than zero", incidentDuration)
+	}
+	if region == "" {
+		region = regionRandom
+	}
+	if rotateNaming != namingNumbered && rotateNaming != namingDated {
+		log.Fatalf("invalid -rotate-naming %q: must be numbered or dated", rotateNaming)
+	}
+	if rotateJitter < 0 {
+		log.Fatalf("invalid -rotate-jitter %s: must not be negative", rotateJitter)
+	}
+	if rotateInterval > 0 && rotateJitter >= rotateInterval {
+		log.Fatalf("invalid -rotate-jitter %s: must be less than -rotate-interval %s", rotateJitter, rotateInterval)
+	}
+	if maxAge < 0 {
+		log.Fatalf("invalid -max-age %s: must not be negative", maxAge)
+	}
+	if !validFormat(logFormat) {
+		log.Fatalf("invalid -format %q: must be one of json, json-array, logfmt, plain, syslog or ecs", logFormat)
+	}
+	switch delimiter {
+	case delimiterNewline, delimiterNull, delimiterCRLF:
+	default:
+		log.Fatalf("invalid -delimiter %q: must be one of newline, null or crlf", delimiter)
+	}
+	if maxLineBytes < 0 {
+		log.Fatalf("invalid -max-line-bytes %d: must not be negative", maxLineBytes)
+	}
+	switch fieldCase {
+	case fieldCaseSnake, fieldCaseCamel:
+	default:
+		log.Fatalf("invalid -field-case %q: must be snake or camel", fieldCase)
+	}
+	if !validTimestampFormat(timestampFormat) {
+		log.Fatalf("invalid -timestamp-format %q: must be one of rfc3339, rfc3339nano, epoch_ms or epoch_ns", timestampFormat)
+	}
+	if err := validOutputs(logOutput); err != nil {
+		log.Fatalf("invalid -output %q: %v", logOutput, err)
+	}
+	if flushInterval <= 0 {
+		log.Fatalf("invalid -flush-interval %s: must be greater than zero", flushInterval)
+	}
+	if redactStrategy != redactMask && redactStrategy != redactHash {
+		log.Fatalf("invalid -redact-strategy %q: must be mask or hash", redactStrategy)
+	}
+	if redactFields != "" {
+		r, err := parseRedaction(redactFields, redactStrategy)
+		if err != nil {
+			log.Fatalf("invalid -redact-fields %q: %v", redactFields, err)
+		}
+		redactor = r
+	}
+	if fallbackStdout && logOutput != outputFile {
+		log.Fatal("invalid -fallback-stdout: requires -output=file alone")
+	}
+	if compressStdout && !hasOutput(outputStdout) {
+		log.Fatal("invalid -compress-stdout: requires -output=stdout")
+	}
+	if hasOutput(outputHTTP) && httpEndpoint == "" {
+		log.Fatal("invalid -http-endpoint: required with -output=http")
+	}
+	if hasOutput(outputOTLP) && otlpEndpoint == "" {
+		log.Fatal("invalid -otlp-endpoint: must not be empty with -output=otlp")
+	}
+	if hasOutput(outputHTTP) || hasOutput(outputOTLP) {
+		if httpBatchSize <= 0 {
+			log.Fatalf("invalid -http-batch-size %d: must be greater than zero", httpBatchSize)
+		}
+		if httpFlushInterval <= 0 {
+			log.Fatalf("invalid -http-flush-interval %s: must be greater than zero", httpFlushInterval)
+		}
+		if httpMaxRetries < 0 {
+			log.Fatalf("invalid -http-max-retries %d: must not be negative", httpMaxRetries)
+		}
+	}
+	if queueSize < 0 {
+		log.Fatalf("invalid -queue-size %d: must not be negative", queueSize)
+	}
+	if queuePolicy != queueBlock && queuePolicy != queueDropOldest {
+		log.Fatalf("invalid -queue-policy %q: must be block or drop-oldest", queuePolicy)
+	}
+	if workers <= 0 {
+		log.Fatalf("invalid -workers %d: must be greater than zero", workers)
+	}
+	if burstSize < 0 {
+		log.Fatalf("invalid -burst %d: must not be negative", burstSize)
+	}
+	if burstPause <= 0 {
+		log.Fatalf("invalid -burst-pause %s: must be greater than zero", burstPause)
+	}
+	switch latencyDist {
+	case latencyUniform, latencyLognormal, latencyBimodal:
+	default:
+		log.Fatalf("invalid -latency-dist %q: must be one of uniform, lognormal or bimodal", latencyDist)
+	}
+	if replaySpeed <= 0 {
+		log.Fatalf("invalid -replay-speed %g: must be greater than zero", replaySpeed)
+	}
+	var err error
+	if minLevel, err = parseLevel(*minLevelName); err != nil {
+		log.Fatalf("invalid -min-level: %v", err)
+	}
+	if runDuration < 0 {
+		log.Fatalf("invalid -duration %s: must not be negative", runDuration)
+	}
+	if maxEntries < 0 {
+		log.Fatalf("invalid -max-entries %d: must not be negative", maxEntries)
+	}
+	if minErrorsPerMinute < 0 || minErrorsPerMinute > maxErrorFloor {
+		log.Fatalf("invalid -min-errors-per-minute %d: must be between 0 and %d", minErrorsPerMinute, maxErrorFloor)
+	}
+	if chaosRate < 0 || chaosRate > 1 {
+		log.Fatalf("invalid -chaos-rate %g: must be between 0 and 1", chaosRate)
+	}
+	if once {
+		if replayFile != "" {
+			log.Fatal("invalid -once: cannot be combined with -replay")
+		}
+		if maxEntries == 0 {
+			maxEntries = 1 // One pass can emit several entries; keep just the first unless -max-entries says otherwise
+		}
+	}
+	if healthStaleAfter <= 0 {
+		log.Fatalf("invalid -health-stale-after %s: must be greater than zero", healthStaleAfter)
+	}
+	if maxWriteFailures < 0 {
+		log.Fatalf("invalid -max-write-failures %d: must not be negative", maxWriteFailures)
+	}
+	if logFile == "" {
+		log.Fatal("invalid -log-file: path must not be empty")
+	}
+}
+
+// logEffectiveConfig writes the resolved settings to stderr as one logfmt line, after defaults,
+// environment, scenario and flags have all been applied, so a deployment can be checked at a glance
+// Keys are the flag names; secrets such as -http-api-key are left out
+func logEffectiveConfig() {
+	fields := []entryField{
+		{"output", logOutput},
+		{"log-file", logFile},
+		{"max-size-bytes", maxSize},
+		{"max-files", maxFiles},
+		{"max-total-size", maxTotalSize.String()},
+		{"rotate-naming", rotateNaming},
+		{"rotate-interval", rotateInterval},
+		{"compress-rotated", compressRotated},
+		{"format", logFormat},
+		{"timestamp-format", timestampFormat},
+		{"field-case", fieldCase},
+		{"rate", rate},
+		{"burst", burstSize},
+		{"workers", workers},
+		{"min-level", minLevel},
+		{"level-weights", levelWeights.String()},
+		{"sample", sampleRates.String()},
+		{"region", region},
+		{"env", appEnv},
+		{"version", appVersion},
+		{"duration", runDuration},
+		{"max-entries", maxEntries},
+		{"queue-size", queueSize},
+		{"queue-policy", queuePolicy},
+	}
+	if hasOutput(outputHTTP) {
+		fields = append(fields, entryField{"http-endpoint", httpEndpoint})
+	}
+	if hasOutput(outputOTLP) {
+		fields = append(fields, entryField{"otlp-endpoint", otlpEndpoint}, entryField{"otlp-headers", otlpHeaders.String()})
+	}
+	if hasOutput(outputHTTP) || hasOutput(outputOTLP) {
+		fields = append(fields, entryField{"http-batch-size", httpBatchSize})
+	}
+	log.Printf("Effective configuration: %s", formatLogfmtLine(fields))
+}
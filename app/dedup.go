@@ -0,0 +1,91 @@
+package main
+
+import "time"
+
+// dedupWindow collapses identical entries written within this long of the first into one
+// entry with repeat_count (0 disables)
+var dedupWindow = time.Duration(0)
+
+// dedupSink holds back each entry until it knows whether the following ones repeat it:
+// consecutive entries with the same level and message within window are written once,
+// with RepeatCount set to how many there were
+type dedupSink struct {
+	next   Sink
+	window time.Duration
+	clock  Clock
+
+	pending *LogEntry // Entry being counted; nil when nothing is held back
+	since   time.Time // When pending was first seen
+	folded  bool      // The latest Write counted its entry as a repeat of pending
+}
+
+// newDedupSink returns a sink that collapses repeated entries before writing them to next
+func newDedupSink(next Sink, window time.Duration, clock Clock) *dedupSink {
+	return &dedupSink{next: next, window: window, clock: clock}
+}
+
+// Write implements Sink
+// An error writing the previously held entry is reported on the entry that released it
+func (s *dedupSink) Write(entry LogEntry) error {
+	now := s.clock.Now()
+	s.folded = false
+	if p := s.pending; p != nil && p.Level == entry.Level && p.Message == entry.Message && now.Sub(s.since) < s.window {
+		p.RepeatCount++
+		s.folded = true
+		return nil
+	}
+	err := s.release()
+	entry.RepeatCount = 1
+	s.pending, s.since = &entry, now
+	return err
+}
+
+// absorbed implements absorber
+func (s *dedupSink) absorbed() bool {
+	return s.folded
+}
+
+// release writes the held entry, if any, marking it with its repeat count when it was repeated
+func (s *dedupSink) release() error {
+	if s.pending == nil {
+		return nil
+	}
+	entry := *s.pending
+	s.pending = nil
+	if entry.RepeatCount == 1 {
+		entry.RepeatCount = 0 // Only collapsed entries carry the field
+	}
+	return s.next.Write(entry)
+}
+
+// Flush implements Sink
+// The held entry is written too once its window has passed, so it does not linger while no
+// further entries arrive; within the window it stays held, to keep counting repeats
+func (s *dedupSink) Flush() error {
+	if s.pending != nil && s.clock.Now().Sub(s.since) >= s.window {
+		if err := s.release(); err != nil {
+			return err
+		}
+	}
+	return s.next.Flush()
+}
+
+// Close implements Sink
+func (s *dedupSink) Close() error {
+	err := s.release()
+	if cerr := s.next.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Reopen implements reopener when the wrapped sink does
+func (s *dedupSink) Reopen() error {
+	if err := s.release(); err != nil {
+		return err
+	}
+	if r, ok := s.next.(reopener); ok {
+		return r.Reopen()
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// TestDedupKeepsSeqContiguous checks that repeats folded into one entry take no seq numbers,
+// so -dedup-window never leaves gaps that look like lost entries
+func TestDedupKeepsSeqContiguous(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+	var buf bytes.Buffer
+	logger := NewLogger(newDedupSink(newWriterSink(&buf), 10*time.Second, clock), clock)
+
+	for _, message := range []string{"flood", "flood", "flood", "other", "flood", "flood"} {
+		clock.advance(time.Second)
+		if err := logger.Write(LogEntry{Level: LevelError, Service: "test", Message: message}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clock.advance(time.Minute) // Past the window: a second flood is a new entry, not a repeat
+	if err := logger.Write(LogEntry{Level: LevelError, Service: "test", Message: "flood"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		seq     int64
+		message string
+		repeats int
+	}{{1, "flood", 3}, {2, "other", 0}, {3, "flood", 2}, {4, "flood", 0}}
+	dec := json.NewDecoder(&buf)
+	i := 0
+	for ; dec.More(); i++ {
+		var entry LogEntry
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatal(err)
+		}
+		if i >= len(want) {
+			t.Fatalf("unexpected extra entry %+v", entry)
+		}
+		if w := want[i]; entry.Seq != w.seq || entry.Message != w.message || entry.RepeatCount != w.repeats {
+			t.Errorf("entry %d: seq %d, message %q, repeat_count %d; want %d, %q, %d", i, entry.Seq, entry.Message, entry.RepeatCount, w.seq, w.message, w.repeats)
+		}
+	}
+	if i != len(want) {
+		t.Errorf("got %d entries, want %d", i, len(want))
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ecsVersion is the Elastic Common Schema version the ecs format follows
+const ecsVersion = "8.11"
+
+// ecsFields maps entry to Elastic Common Schema field names, in dotted form
+// To carry a new LogEntry field into ECS output, add its mapping here; zero values are
+// left out, like omitempty in the JSON format
+func ecsFields(entry LogEntry) []entryField {
+	fields := []entryField{
+		{"@timestamp", entry.Timestamp},
+		{"log.level", strings.ToLower(string(entry.Level))},
+		{"event.severity", entry.SeverityNumber},
+		{"service.name", entry.Service},
+		{"message", entry.Message},
+		{"user.id", entry.UserID},
+		{"url.path", entry.Endpoint},
+		{"event.duration", int64(entry.ResponseTime) * 1e6}, // ECS durations are in nanoseconds
+		{"http.response.status_code", entry.StatusCode},
+		{"service.target.name", entry.DownstreamService},
+		{"labels.downstream_latency_ms", entry.DownstreamLatency},
+		{"cloud.region", entry.Region},
+		{"labels.component", entry.Component},
+		{"trace.id", entry.TraceID},
+		{"span.id", entry.SpanID},
+		{"error.code", entry.ErrorCode},
+		{"error.type", entry.ErrorType},
+		{"error.stack_trace", entry.StackTrace},
+		{"log.origin.file.name", entry.File},
+		{"log.origin.file.line", entry.Line},
+		{"host.hostname", entry.Hostname},
+		{"kubernetes.pod.name", entry.PodName},
+		{"service.environment", entry.Env},
+		{"service.version", entry.Version},
+		{"event.sequence", entry.Seq},
+		{"labels.heartbeat_sequence", entry.Sequence},
+		{"ecs.version", ecsVersion},
+	}
+	// Custom attributes become ECS labels, which are flat keyword values
+	keys := make([]string, 0, len(entry.Attributes))
+	for k := range entry.Attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fields = append(fields, entryField{"labels." + k, entry.Attributes[k]})
+	}
+	if entry.Sampled {
+		fields = append(fields, entryField{"labels.sampled", "true"})
+	}
+	if entry.Truncated {
+		fields = append(fields, entryField{"labels.truncated", "true"})
+	}
+	return fields
+}
+
+// formatECSDocument renders entry as an ECS JSON document, nesting dotted names into objects
+// (log.level becomes {"log": {"level": ...}}) as ECS specifies
+func formatECSDocument(entry LogEntry) ([]byte, error) {
+	doc := map[string]interface{}{}
+	for _, f := range ecsFields(entry) {
+		if f.value == nil || reflect.ValueOf(f.value).IsZero() {
+			continue
+		}
+		path := strings.Split(f.key, ".")
+		if f.key == "@timestamp" {
+			path = []string{f.key}
+		}
+		obj := doc
+		for _, name := range path[:len(path)-1] {
+			child, ok := obj[name].(map[string]interface{})
+			if !ok {
+				child = map[string]interface{}{}
+				obj[name] = child
+			}
+			obj = child
+		}
+		obj[path[len(path)-1]] = f.value
+	}
+	return json.Marshal(doc)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// minErrorsPerMinute is the fewest ERROR entries written in any minute (0 disables): when the
+// random mix falls short, extra component failures are injected so alert demos always fire
+var minErrorsPerMinute = 0
+
+// maxErrorFloor is the highest -min-errors-per-minute: one slot per millisecond. Beyond
+// about 6e10 the slot would round down to nothing, which time.NewTicker rejects
+const maxErrorFloor = 60000
+
+// errorFloor makes sure at least perMinute ERROR entries are written every minute until ctx
+// is done. The minute is split into perMinute slots and, at the end of each, failures are
+// injected until the minute's errors have caught up with the slots elapsed, so injected errors
+// are spread out rather than bunched at the end. They carry the attribute synthetic=error-floor
+func errorFloor(ctx context.Context, logger *Logger, rng *rand.Rand, perMinute int) {
+	t := time.NewTicker(time.Minute / time.Duration(perMinute))
+	defer t.Stop()
+	base := logsGenerated.snapshot()[string(LevelError)]
+	slots := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		slots++
+		written := logsGenerated.snapshot()[string(LevelError)] - base
+		for ; written < int64(slots); written++ {
+			if !reserveEntry() {
+				return
+			}
+			attributes := randomAttributes(rng)
+			attributes["synthetic"] = "error-floor"
+			component, service := components[rng.Intn(len(components))], services[rng.Intn(len(services))]
+			if backend, ok := endpointBackends[endpoints[rng.Intn(len(endpoints))]]; ok {
+				component, service = backend, backend // Failing where randomIteration would, see endpointBackends
+			}
+			entry := componentFailure(rng, service, component, randomHex(rng, 16), attributes)
+			entry.Message = renderMessage(entry)
+			annotate(&entry)
+			submit(ctx, logger, entry)
+		}
+		if slots == perMinute {
+			// Start the next minute; surplus errors from this one do not carry over
+			slots, base = 0, logsGenerated.snapshot()[string(LevelError)]
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"log"
+	"os"
+)
+
+// fallbackStdout switches to stdout when the log file keeps failing, instead of giving up
+var fallbackStdout = false
+
+// defaultMaxWriteFailures is the -max-write-failures default, and the fallback threshold when
+// that is 0
+const defaultMaxWriteFailures = 10
+
+// fallbackSink writes to primary until threshold writes in a row have failed, then closes it
+// and writes to stdout for the rest of the run, so entries keep flowing to a collector
+// reading the container's stdout when the log volume goes away or turns read-only
+type fallbackSink struct {
+	primary   Sink
+	threshold int
+	failures  int  // Consecutive failed writes to primary
+	switched  bool // Writing to stdout since primary failed threshold times
+	stdout    Sink
+}
+
+// newFallbackSink returns a sink writing to primary, falling back to stdout after threshold
+// consecutive failures
+func newFallbackSink(primary Sink, threshold int) *fallbackSink {
+	return &fallbackSink{primary: primary, threshold: threshold}
+}
+
+// active returns the sink entries currently go to
+func (s *fallbackSink) active() Sink {
+	if s.switched {
+		return s.stdout
+	}
+	return s.primary
+}
+
+// Write implements Sink
+// The write that reaches the threshold is retried on stdout, so it is not lost either
+func (s *fallbackSink) Write(entry LogEntry) error {
+	if s.switched {
+		return s.stdout.Write(entry)
+	}
+	err := s.primary.Write(entry)
+	if err == nil {
+		s.failures = 0
+		return nil
+	}
+	if s.failures++; s.failures < s.threshold {
+		return err
+	}
+	log.Printf("warning: %d writes in a row failed, the last with: %v; writing to stdout from now on (-fallback-stdout)", s.failures, err)
+	if cerr := s.primary.Close(); cerr != nil {
+		log.Printf("warning: failed to close the failing output: %v", cerr)
+	}
+	s.switched, s.stdout = true, newWriterSink(os.Stdout)
+	return s.stdout.Write(entry)
+}
+
+// Flush implements Sink
+func (s *fallbackSink) Flush() error {
+	return s.active().Flush()
+}
+
+// Close implements Sink
+func (s *fallbackSink) Close() error {
+	return s.active().Close()
+}
+
+// Reopen implements reopener when the active sink does; after the switch to stdout there is
+// nothing to reopen
+func (s *fallbackSink) Reopen() error {
+	if r, ok := s.active().(reopener); ok {
+		return r.Reopen()
+	}
+	return nil
+}
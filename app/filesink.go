@@ -0,0 +1,809 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// fileConfig is where a fileSink writes and when it rotates
+type fileConfig struct {
+	path     string        // Active log file; rotated files get .1, .2, ... appended
+	maxSize  int64         // Rotate once the file reaches this many bytes
+	maxFiles int           // Rotated files to keep
+	compress bool          // Gzip rotated files
+	interval time.Duration // Also rotate files older than this (0 disables)
+	strict   bool          // Rotate before a write would exceed maxSize, so no file ever does
+	meta     bool          // Record a .meta sidecar for each rotated file
+	naming   string        // How rotated files are named: namingNumbered or namingDated
+	maxAge   time.Duration // With namingDated, also remove rotated files older than this (0 disables)
+	maxTotal int64         // Remove the oldest rotated files once together they exceed this many bytes (0 disables)
+	clock    Clock         // Decides when files are due for age and calendar rotation
+	mode     os.FileMode   // Permissions of newly created log files; rotated files keep them
+	jitter   time.Duration // This instance's offset to the time-based rotation triggers, see rotationJitter
+	fsync    fsyncPolicy   // When written entries are forced to disk
+	external bool          // Rotation is left to an external tool such as logrotate
+	truncate bool          // Empty the file before the first write instead of appending to what a previous run left
+	clean    bool          // With truncate, also remove the rotated files a previous run left
+	fsys     fileSystem    // Where the log and its numbered rotated files live; nil means the real filesystem
+}
+
+// fileSystem is the file operations a fileSink performs on its log and numbered rotated files,
+// so tests can run the rotation chain in memory. Compression, .meta sidecars, dated naming and
+// json-array resumption still work on the real filesystem only
+type fileSystem interface {
+	OpenFile(name string, flag int, perm os.FileMode) (openFile, error)
+	Stat(name string) (os.FileInfo, error)
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+	SameFile(a, b os.FileInfo) bool
+}
+
+// openFile is an open log file, as returned by fileSystem.OpenFile
+type openFile interface {
+	io.Writer
+	Stat() (os.FileInfo, error)
+	Chmod(mode os.FileMode) error
+	Sync() error
+	Close() error
+}
+
+// osFS is the fileSystem of the operating system
+type osFS struct{}
+
+// OpenFile implements fileSystem
+func (osFS) OpenFile(name string, flag int, perm os.FileMode) (openFile, error) {
+	f, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err // Not f, which would be a non-nil openFile holding a nil *os.File
+	}
+	return f, nil
+}
+
+// Stat implements fileSystem
+func (osFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+// Rename implements fileSystem
+func (osFS) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+// Remove implements fileSystem
+func (osFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+// SameFile implements fileSystem
+func (osFS) SameFile(a, b os.FileInfo) bool {
+	return os.SameFile(a, b)
+}
+
+// Rotated file naming strategies, selectable with -rotate-naming
+const (
+	namingNumbered = "numbered" // app.log.1, app.log.2, ... shifted on every rotation
+	namingDated    = "dated"    // app-2024-06-01.log, named after the UTC day the file was started
+)
+
+// statInterval is how often a fileSink checks that its path still refers to the open file
+// Between checks the file's size is tracked in memory, saving a stat per write; an entry
+// written after an external move but before the next check lands in the moved file
+const statInterval = time.Second
+
+// fileSink appends entries to a log file, rotating it by size and, optionally, by age
+// The file is held open across writes and only reopened after rotation, including a rotation
+// done externally by moving or deleting the file
+type fileSink struct {
+	fileConfig
+
+	file     openFile
+	out      *writerSink // Buffers entries for file; nil while no file is open
+	pipe     bool        // The file is a named pipe, which has nothing to sync
+	created  time.Time   // When the active file was started, for time-based rotation
+	lastSync time.Time   // When the file was last synced, for -fsync=interval
+	size     int64       // Size of the active file when it was opened; its writes since are counted by out
+	lastStat time.Time   // When the path was last checked for an external move, see statInterval
+	started  bool        // The truncate and clean start has been done
+}
+
+// newFileSink returns a sink for cfg; the file is opened by the first write
+// A nil cfg.clock means the wall clock, a nil cfg.fsys the real filesystem and a zero
+// cfg.mode 0644
+func newFileSink(cfg fileConfig) *fileSink {
+	if cfg.clock == nil {
+		cfg.clock = realClock{}
+	}
+	if cfg.fsys == nil {
+		cfg.fsys = osFS{}
+	}
+	if cfg.mode == 0 {
+		cfg.mode = 0644
+	}
+	return &fileSink{fileConfig: cfg}
+}
+
+// Write implements Sink, rotating first if the active file is due
+func (s *fileSink) Write(entry LogEntry) error {
+	line, err := encodeEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	// Bytes this entry will add, including its delimiter or, for json-array, the separator and
+	// the share of the closing bracket written on Close
+	pending := int64(len(line) + len(recordDelimiter()))
+	if logFormat == formatJSONArray {
+		pending = int64(len(line) + 5)
+	}
+
+	// Before the first rotation check, which would otherwise rotate the previous run's file
+	if s.truncate && !s.started {
+		s.started = true
+		s.startFresh()
+	}
+
+	// On failure keep appending to the current file, which is still intact, and retry on the next write
+	if err := s.rotate(pending); err != nil {
+		log.Printf("warning: log rotation failed, continuing with current file: %v", err)
+	}
+
+	// Open the log file on first use, or if reopening after rotation failed
+	if s.file == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+	if err := s.out.writeLine(line); err != nil {
+		s.discard()
+		return err
+	}
+	if err := s.syncIfDue(); err != nil {
+		s.discard()
+		return err
+	}
+	return nil
+}
+
+// syncIfDue flushes the buffer and fsyncs the file when the fsync policy calls for it
+func (s *fileSink) syncIfDue() error {
+	now := s.clock.Now()
+	switch {
+	case s.pipe:
+		return nil
+	case s.fsync.mode == fsyncAlways:
+	case s.fsync.mode == fsyncInterval && now.Sub(s.lastSync) >= s.fsync.every:
+	default:
+		return nil
+	}
+	s.lastSync = now
+	if err := s.out.Flush(); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("fsync %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// rotate handles log file rotation when the current log file exceeds maxSize
+// or, if interval is set, once it is older than interval - whichever comes first
+// In strict mode it instead rotates when writing pending more bytes would exceed maxSize, so files
+// stay within the limit; an entry larger than maxSize still goes into a fresh file of its own
+// It shifts existing rotated files (app.log.1 -> app.log.2, etc.) and moves current log to app.log.1
+// With dated naming it moves the current log to app-2024-06-01.log instead, and also rotates at UTC midnight
+// A non-nil error means the active log file could not be moved and was left in place
+func (s *fileSink) rotate(pending int64) error {
+	now := s.clock.Now()
+	if s.file == nil || now.Sub(s.lastStat) >= statInterval {
+		if s.checkPath(now) {
+			return nil
+		}
+	}
+	if s.pipe || s.external {
+		return nil // A pipe has no size to limit and nothing to rotate; logrotate does its own
+	}
+
+	// Check if current log file exceeds size limit or age
+	size := s.size
+	if s.out != nil {
+		size += s.out.written // Includes entries not yet flushed, which count towards the limit too
+	}
+	full := size >= s.maxSize
+	if s.strict {
+		full = size > 0 && size+pending > s.maxSize
+	}
+	expired := s.interval > 0 && size > 0 && now.Sub(s.created) >= s.interval+s.jitter
+	if s.naming == namingDated && size > 0 && utcDay(s.created.Add(-s.jitter)) != utcDay(now.Add(-s.jitter)) {
+		expired = true // Dated files never span a UTC midnight, so each holds exactly its day
+	}
+	if !full && !expired {
+		return nil // No rotation needed
+	}
+
+	// Flush, sync and close the handle so buffered entries are on disk in the file being
+	// rotated, not orphaned in memory or written after the rename into the fresh file
+	// Logger serializes writes, so no writer can slip an entry into the renamed inode
+	// or find the handle missing mid-rotation
+	if err := s.Close(); err != nil {
+		log.Printf("warning: failed to flush %s before rotation: %v", s.path, err)
+	}
+
+	rotated := s.path + ".1"
+	if s.naming == namingDated {
+		rotated = datedName(s.path, s.created.Add(-s.jitter)) // Named after the day its jittered period covers
+	} else {
+		shiftNumbered(s.fsys, s.path, s.maxFiles)
+	}
+
+	// Move current active log file to app.log.1 (or its dated name)
+	// If this fails the active file is untouched, so abort rather than leave a half-rotated chain
+	if err := s.fsys.Rename(s.path, rotated); err != nil {
+		s.reopen()
+		return fmt.Errorf("rotate %s -> %s: %w", s.path, rotated, err)
+	}
+	s.created = now
+	logRotations.Add(1)
+
+	// Point the handle at the fresh file straight away, before the (slower) compression
+	s.reopen()
+
+	// Record the sidecar from the plain file, before compression replaces it
+	if s.meta {
+		if err := writeRotationMeta(rotated); err != nil {
+			log.Printf("warning: failed to record %s.meta: %v", rotated, err)
+		}
+	}
+
+	// Compress the freshly rotated file; on failure the plain file is kept instead
+	if s.compress {
+		if err := compressFile(rotated); err != nil {
+			log.Printf("warning: failed to compress rotated log %s: %v", rotated, err)
+		}
+	}
+
+	// Dated files are not shifted, so retention is applied once the new one is in place
+	if s.naming == namingDated {
+		pruneDated(s.path, s.maxFiles, s.maxAge, now)
+	}
+	// Size retention goes last, so it counts the files as they will stay: compressed and pruned
+	if s.maxTotal > 0 {
+		pruneTotalSize(s.fsys, s.rotatedFiles(), s.maxTotal)
+	}
+	return nil
+}
+
+// checkPath stats the log path, reopening if something else (e.g. logrotate) moved or
+// deleted the file under us, and picks up the size of a file that is not open yet
+// It reports true when there is no file at the path, so nothing to rotate
+func (s *fileSink) checkPath(now time.Time) bool {
+	s.lastStat = now
+	info, err := s.fsys.Stat(s.path)
+	if s.file != nil && (err != nil || !s.holds(info)) {
+		// The handle still points at the old inode, so close it and let Write open the path afresh
+		if !s.external { // Expected with external rotation, when a write beats the SIGHUP
+			log.Printf("warning: %s was moved or removed externally, reopening it", s.path)
+		}
+		if err := s.Close(); err != nil {
+			log.Printf("warning: failed to flush %s before reopening: %v", s.path, err)
+		}
+		info, err = s.fsys.Stat(s.path)
+	}
+	if err != nil {
+		s.created = now // File will be created fresh by the next write
+		return true
+	}
+	if s.created.IsZero() {
+		// The process (re)started with an existing file whose creation time we never saw.
+		// ModTime is the closest portable approximation: a file left idle for longer than
+		// the interval rotates straight away, otherwise the interval resumes from the last write
+		s.created = info.ModTime()
+	}
+	if s.file == nil {
+		s.size, s.pipe = info.Size(), info.Mode()&os.ModeNamedPipe != 0
+	}
+	return false
+}
+
+// shiftNumbered makes room for a new path.1, dropping path.maxFiles and renaming the other
+// rotated files of path one number up. It only touches the rotated files, never path itself,
+// so it can be exercised on its own against a directory of numbered files
+func shiftNumbered(fsys fileSystem, path string, maxFiles int) {
+	// Drop the oldest rotated file (app.log.5) first rather than relying on the shift to
+	// rename over it, which fails on platforms where the destination must not exist
+	for _, suffix := range []string{"", ".gz", ".meta"} {
+		oldest := fmt.Sprintf("%s.%d%s", path, maxFiles, suffix)
+		if err := fsys.Remove(oldest); err != nil && !os.IsNotExist(err) {
+			log.Printf("warning: failed to remove oldest rotated log %s: %v", oldest, err)
+		}
+	}
+
+	// Shift existing rotated files: app.log.4 -> app.log.5, app.log.3 -> app.log.4, etc.
+	// Both plain and gzipped variants are shifted, since compression can be toggled between runs
+	// or may have failed for an individual file, and so are their .meta sidecars
+	// A failed shift only affects historical files, so warn and keep going
+	for i := maxFiles - 1; i > 0; i-- {
+		for _, suffix := range []string{"", ".gz", ".meta"} {
+			old := fmt.Sprintf("%s.%d%s", path, i, suffix)
+			new := fmt.Sprintf("%s.%d%s", path, i+1, suffix)
+			if err := fsys.Rename(old, new); err != nil && !os.IsNotExist(err) {
+				log.Printf("warning: failed to shift rotated log %s -> %s: %v", old, new, err)
+			}
+		}
+	}
+}
+
+// rotatedFiles returns the rotated files of the log, plain or gzipped, newest first
+func (s *fileSink) rotatedFiles() []string {
+	if s.naming == namingDated {
+		return datedRotated(s.path)
+	}
+	var files []string
+	for i := 1; i <= s.maxFiles; i++ {
+		for _, suffix := range []string{"", ".gz"} {
+			name := fmt.Sprintf("%s.%d%s", s.path, i, suffix)
+			if _, err := s.fsys.Stat(name); err == nil {
+				files = append(files, name)
+			}
+		}
+	}
+	return files
+}
+
+// pruneTotalSize keeps the newest of rotated (ordered newest first) that together take up at
+// most limit bytes, removing the rest with their .meta sidecars. The newest is kept even if it
+// alone is over the limit, so rotation never leaves no history at all. It works alongside
+// -max-files and -max-age: a file is kept only if every one of them allows it
+func pruneTotalSize(fsys fileSystem, rotated []string, limit int64) {
+	var total int64
+	for i, name := range rotated {
+		info, err := fsys.Stat(name)
+		if err != nil {
+			continue
+		}
+		if total += info.Size(); total <= limit || i == 0 {
+			continue
+		}
+		meta := strings.TrimSuffix(name, ".gz") + ".meta"
+		for _, name := range []string{name, meta} {
+			if err := fsys.Remove(name); err != nil && !os.IsNotExist(err) {
+				log.Printf("warning: failed to remove rotated log %s over -max-total-size: %v", name, err)
+			}
+		}
+	}
+}
+
+// startFresh empties the log file and, with clean, removes its rotated files and their .meta
+// sidecars, so a benchmark run starts from nothing. A named pipe is left alone; failures
+// are logged and the run carries on appending
+func (s *fileSink) startFresh() {
+	if info, err := s.fsys.Stat(s.path); err == nil && info.Mode().IsRegular() {
+		f, err := s.fsys.OpenFile(s.path, os.O_WRONLY|os.O_TRUNC, 0)
+		if err == nil {
+			err = f.Close()
+		}
+		if err != nil {
+			log.Printf("warning: failed to truncate %s: %v", s.path, err)
+		}
+	}
+	if !s.clean {
+		return
+	}
+	for _, name := range s.rotatedFiles() {
+		for _, name := range []string{name, strings.TrimSuffix(name, ".gz") + ".meta"} {
+			if err := s.fsys.Remove(name); err != nil && !os.IsNotExist(err) {
+				log.Printf("warning: failed to remove rotated log %s: %v", name, err)
+			}
+		}
+	}
+}
+
+// holds reports whether the open handle still refers to the file described by info
+func (s *fileSink) holds(info os.FileInfo) bool {
+	open, err := s.file.Stat()
+	return err == nil && s.fsys.SameFile(open, info)
+}
+
+// rotationJitter returns this instance's offset, within ±max, to the time-based rotation
+// triggers, so replicas started together do not all rotate at the same moment (e.g. at
+// midnight) and spike I/O and downstream ingestion. It is derived from the hostname, pod
+// name and process ID: stable for the life of the process, but different on every instance
+func rotationJitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s/%s/%d", hostname, podName, os.Getpid())
+	rng := rand.New(rand.NewSource(int64(h.Sum64())))
+	return time.Duration(rng.Int63n(int64(2*max)+1)) - max
+}
+
+// reopen reopens the log file after Close during rotation
+// A failure leaves the file closed; Write then retries the open and reports the error
+func (s *fileSink) reopen() {
+	if err := s.open(); err != nil {
+		log.Printf("warning: failed to reopen %s after rotation: %v", s.path, err)
+	}
+}
+
+// open opens the log file for appending (creating it if needed) and wraps it in a buffered writer
+// A named pipe is opened non-blocking, so with no reader attached the open fails with ENXIO
+// instead of stalling every writer; the handle then stays open for as long as the reader does
+func (s *fileSink) open() error {
+	flags := os.O_APPEND | os.O_CREATE | os.O_WRONLY
+	pipe := false
+	info, statErr := s.fsys.Stat(s.path)
+	if statErr == nil && info.Mode()&os.ModeNamedPipe != 0 {
+		flags, pipe = os.O_WRONLY|syscall.O_NONBLOCK, true
+	}
+
+	arrayEntries := -1
+	if logFormat == formatJSONArray && !pipe { // Reading back a pipe would consume the reader's data
+		n, err := resumeJSONArray(s.path)
+		if err != nil {
+			return err
+		}
+		arrayEntries = n
+	}
+
+	file, err := s.fsys.OpenFile(s.path, flags, s.mode)
+	if err != nil {
+		return err
+	}
+	if os.IsNotExist(statErr) {
+		// The umask may have cleared bits of mode; a fresh file gets exactly what was asked for
+		if err := file.Chmod(s.mode); err != nil {
+			log.Printf("warning: failed to set mode %#o on %s: %v", s.mode, s.path, err)
+		}
+	}
+	s.size = 0
+	if !pipe {
+		// Stat once here, after any json-array trimming, and count writes from then on
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return err
+		}
+		s.size = info.Size()
+	}
+	s.file, s.pipe = file, pipe
+	s.out = newWriterSink(file)
+	s.out.arrayEntries = arrayEntries
+	return nil
+}
+
+// Flush implements Sink, also syncing the file when -fsync=interval is due; it is a no-op
+// when nothing is open
+func (s *fileSink) Flush() error {
+	if s.out == nil {
+		return nil
+	}
+	if err := s.out.Flush(); err != nil {
+		s.discard()
+		return err
+	}
+	if err := s.syncIfDue(); err != nil {
+		s.discard()
+		return err
+	}
+	return nil
+}
+
+// Close implements Sink, flushing any buffered entries, fsyncing and closing the active log
+// file, so everything written so far is on disk before shutdown or before rotation renames,
+// digests or compresses the file. It is a no-op when nothing is open
+func (s *fileSink) Close() error {
+	var err error
+	if s.out != nil {
+		err = s.out.Close()
+	}
+	if s.file != nil && !s.pipe && err == nil {
+		if err = s.file.Sync(); err != nil {
+			err = fmt.Errorf("fsync %s: %w", s.path, err)
+		}
+	}
+	if s.file != nil {
+		if cerr := s.file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	s.file, s.out = nil, nil
+	return err
+}
+
+// Reopen implements reopener: it flushes and closes the file, and the next write opens
+// the path afresh, picking up a file an external tool rotated in
+func (s *fileSink) Reopen() error {
+	return s.Close()
+}
+
+// discard drops the active file after an I/O error without flushing it
+// The next write starts again from a fresh handle, with the json-array state
+// recomputed from the file
+func (s *fileSink) discard() {
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file, s.out = nil, nil
+}
+
+// routedSink spreads entries over several independently rotated files, picking each
+// entry's file with route, e.g. one file per service
+type routedSink struct {
+	cfg   fileConfig            // Template for every file; path is replaced per route
+	route func(LogEntry) string // Returns the path an entry belongs in
+	files map[string]*fileSink  // Open files by path, created on first use
+}
+
+// newRoutedSink returns a sink writing each entry to the file chosen by route
+func newRoutedSink(cfg fileConfig, route func(LogEntry) string) *routedSink {
+	return &routedSink{cfg: cfg, route: route, files: map[string]*fileSink{}}
+}
+
+// Write implements Sink
+func (s *routedSink) Write(entry LogEntry) error {
+	path := s.route(entry)
+	file, ok := s.files[path]
+	if !ok {
+		cfg := s.cfg
+		cfg.path = path
+		file = newFileSink(cfg)
+		s.files[path] = file
+	}
+	return file.Write(entry)
+}
+
+// Flush implements Sink, flushing every file and returning the first error
+func (s *routedSink) Flush() error {
+	var err error
+	for _, file := range s.files {
+		if ferr := file.Flush(); err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
+
+// Close implements Sink, closing every file and returning the first error
+func (s *routedSink) Close() error {
+	var err error
+	for _, file := range s.files {
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Reopen implements reopener for every file
+func (s *routedSink) Reopen() error {
+	return s.Close()
+}
+
+// servicePath routes entries to <service>.log next to logFile, so each service
+// gets its own file as with separately deployed microservices
+func servicePath(entry LogEntry) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r < ' ' {
+			return '_'
+		}
+		return r
+	}, entry.Service)
+	if name == "" || name == "." || name == ".." {
+		name = "unknown"
+	}
+	return filepath.Join(filepath.Dir(logFile), name+".log")
+}
+
+// ensureLogDir creates dir and any missing parents with mode, so pointing -log-file at
+// a fresh volume works without creating the directory by hand
+// Like the log file, a directory it creates gets mode exactly, regardless of the umask
+func ensureLogDir(dir string, mode os.FileMode) error {
+	_, statErr := os.Stat(dir)
+	if err := os.MkdirAll(dir, mode); err != nil {
+		if errors.Is(err, fs.ErrPermission) {
+			return fmt.Errorf("cannot create log directory %s: permission denied; create it beforehand or run as a user allowed to write to its parent", dir)
+		}
+		return fmt.Errorf("cannot create log directory %s: %w", dir, err)
+	}
+	if os.IsNotExist(statErr) {
+		if err := os.Chmod(dir, mode); err != nil {
+			return fmt.Errorf("cannot set mode %#o on log directory %s: %w", mode, dir, err)
+		}
+	}
+	return nil
+}
+
+// permOf returns the permission bits of path, for giving derived files (.gz, .meta)
+// the same access as the log they were made from
+func permOf(path string) os.FileMode {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0644
+	}
+	return info.Mode().Perm()
+}
+
+// fileMode is a flag.Value for octal permission bits such as 0755
+type fileMode os.FileMode
+
+// String implements flag.Value
+func (m *fileMode) String() string {
+	return fmt.Sprintf("%#o", uint32(*m))
+}
+
+// Set implements flag.Value
+func (m *fileMode) Set(value string) error {
+	n, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || n > 0777 {
+		return fmt.Errorf("%q is not an octal permission such as 0755", value)
+	}
+	*m = fileMode(n)
+	return nil
+}
+
+// byteSize is a flag.Value for a number of bytes, optionally suffixed KB, MB or GB (powers of 1024)
+type byteSize int64
+
+// byteUnits are the suffixes byteSize accepts, largest first
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}}
+
+// String implements flag.Value, using the largest unit that divides the size evenly
+func (b *byteSize) String() string {
+	for _, u := range byteUnits {
+		if *b != 0 && int64(*b)%u.size == 0 {
+			return fmt.Sprintf("%d%s", int64(*b)/u.size, u.suffix)
+		}
+	}
+	return strconv.FormatInt(int64(*b), 10)
+}
+
+// Set implements flag.Value
+func (b *byteSize) Set(value string) error {
+	number, scale := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(value)), "B"), int64(1)
+	for _, u := range byteUnits {
+		if trimmed, ok := strings.CutSuffix(number, u.suffix[:1]); ok {
+			number, scale = trimmed, u.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64/scale {
+		return fmt.Errorf("%q is not a size such as 500MB or 2GB", value)
+	}
+	*b = byteSize(n * scale)
+	return nil
+}
+
+// fsync policies for -fsync
+const (
+	fsyncOff      = "off"      // Leave writeback to the OS (default)
+	fsyncAlways   = "always"   // fsync after every entry
+	fsyncInterval = "interval" // fsync on the first write after every interval
+)
+
+// fsyncPolicy is a flag.Value for off, always or interval=DURATION
+type fsyncPolicy struct {
+	mode  string
+	every time.Duration // With fsyncInterval
+}
+
+// String implements flag.Value
+func (p *fsyncPolicy) String() string {
+	if p.mode == fsyncInterval {
+		return fmt.Sprintf("%s=%s", p.mode, p.every)
+	}
+	if p.mode == "" {
+		return fsyncOff
+	}
+	return p.mode
+}
+
+// Set implements flag.Value; a bare number of seconds is accepted as the interval too
+func (p *fsyncPolicy) Set(value string) error {
+	mode, every, hasEvery := strings.Cut(value, "=")
+	switch {
+	case (mode == fsyncOff || mode == fsyncAlways) && !hasEvery:
+		*p = fsyncPolicy{mode: mode}
+		return nil
+	case mode == fsyncInterval && hasEvery:
+		d, err := time.ParseDuration(every)
+		if n, nerr := strconv.Atoi(every); err != nil && nerr == nil {
+			d, err = time.Duration(n)*time.Second, nil
+		}
+		if err != nil || d <= 0 {
+			return fmt.Errorf("%q is not a positive interval such as 5s", every)
+		}
+		*p = fsyncPolicy{mode: mode, every: d}
+		return nil
+	}
+	return fmt.Errorf("%q must be off, always or interval=DURATION", value)
+}
+
+// compressFile gzips path to path.gz, with the same permissions, and removes the original
+// The archive is written to a temporary file first so a crash never leaves a truncated .gz behind
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close() // Also closed before removing path, which Windows refuses while it is open
+
+	mode := permOf(path)
+	tmp := path + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	err = dst.Chmod(mode) // Undo the umask, as for the log file itself
+	if err == nil {
+		_, err = io.Copy(zw, src)
+	}
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path+".gz")
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	src.Close()
+	return os.Remove(path)
+}
+
+// resumeJSONArray prepares an existing json-array file at path for appending by removing
+// its closing bracket. It returns the number of entries already in the array (only whether
+// it is zero matters for comma placement), or -1 if the file is missing or empty
+func resumeJSONArray(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) || (err == nil && len(data) == 0) {
+		return -1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if data[0] != '[' {
+		return 0, fmt.Errorf("%s exists but is not a JSON array; move it aside before using -format=%s", path, formatJSONArray)
+	}
+
+	// A cleanly closed file ends in "\n]\n" (or "[\n]\n" when empty); a crashed run leaves no bracket
+	trimmed := len(data)
+	switch {
+	case string(data) == "[\n]\n":
+		trimmed -= 2
+	case bytes.HasSuffix(data, []byte("\n]\n")):
+		trimmed -= 3
+	}
+	if trimmed != len(data) {
+		if err := os.Truncate(path, int64(trimmed)); err != nil {
+			return 0, err
+		}
+	}
+	if trimmed <= 2 {
+		return 0, nil // Only the opening "[\n" remains
+	}
+	return 1, nil
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestShiftNumbered checks that shiftNumbered moves every rotated file one index up, oldest
+// first so nothing is overwritten, and drops the file at maxFiles
+func TestShiftNumbered(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxFiles int
+		existing map[string]string // Rotated file suffix (after app.log) -> content
+		want     map[string]string // Same, after the shift
+	}{
+		{
+			name:     "single file is dropped",
+			maxFiles: 1,
+			existing: map[string]string{".1": "one"},
+			want:     map[string]string{},
+		},
+		{
+			name:     "full chain of three",
+			maxFiles: 3,
+			existing: map[string]string{".1": "one", ".2": "two", ".3": "three"},
+			want:     map[string]string{".2": "one", ".3": "two"},
+		},
+		{
+			name:     "full chain of five",
+			maxFiles: 5,
+			existing: map[string]string{".1": "one", ".2": "two", ".3": "three", ".4": "four", ".5": "five"},
+			want:     map[string]string{".2": "one", ".3": "two", ".4": "three", ".5": "four"},
+		},
+		{
+			name:     "gzipped chain",
+			maxFiles: 3,
+			existing: map[string]string{".1.gz": "one", ".2.gz": "two", ".3.gz": "three"},
+			want:     map[string]string{".2.gz": "one", ".3.gz": "two"},
+		},
+		{
+			name:     "mixed plain and gzipped with meta sidecars",
+			maxFiles: 3,
+			existing: map[string]string{".1": "one", ".1.meta": "meta one", ".2.gz": "two", ".2.meta": "meta two", ".3": "three", ".3.meta": "meta three"},
+			want:     map[string]string{".2": "one", ".2.meta": "meta one", ".3.gz": "two", ".3.meta": "meta two"},
+		},
+		{
+			name:     "gaps in the chain stay gaps",
+			maxFiles: 5,
+			existing: map[string]string{".1": "one", ".3": "three", ".5": "five"},
+			want:     map[string]string{".2": "one", ".4": "three"},
+		},
+		{
+			name:     "gap at the start",
+			maxFiles: 3,
+			existing: map[string]string{".2.gz": "two", ".3.gz": "three"},
+			want:     map[string]string{".3.gz": "two"},
+		},
+		{
+			name:     "no rotated files",
+			maxFiles: 5,
+			existing: map[string]string{},
+			want:     map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "app.log")
+			writeFile(t, path, "active") // Never touched by the shift
+			for suffix, content := range tt.existing {
+				writeFile(t, path+suffix, content)
+			}
+
+			shiftNumbered(osFS{}, path, tt.maxFiles)
+
+			want := map[string]string{"": "active"}
+			for suffix, content := range tt.want {
+				want[suffix] = content
+			}
+			got := readChain(t, path)
+			if len(got) != len(want) {
+				t.Errorf("files after shift: got %v, want %v", keys(got), keys(want))
+			}
+			for suffix, content := range want {
+				if got[suffix] != content {
+					t.Errorf("app.log%s: got %q, want %q", suffix, got[suffix], content)
+				}
+			}
+		})
+	}
+}
+
+// writeFile creates path with content, failing the test on error
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readChain returns the content of path and every file next to it whose name starts with it,
+// keyed by the rest of the name
+func readChain(t *testing.T, path string) map[string]string {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := filepath.Base(path)
+	files := map[string]string{}
+	for _, e := range entries {
+		if len(e.Name()) < len(base) || e.Name()[:len(base)] != base {
+			t.Errorf("unexpected file %s", e.Name())
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(filepath.Dir(path), e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[e.Name()[len(base):]] = string(data)
+	}
+	return files
+}
+
+// keys returns the keys of m in sorted order, for failure messages
+func keys(m map[string]string) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// writeAndTrackRotations writes each of entries through logger, returning for each rotation
+// of path how many entries had been written before it
+func writeAndTrackRotations(t *testing.T, logger *Logger, m *memFS, path string, entries []LogEntry) []int {
+	t.Helper()
+	var rotations []int
+	for i, entry := range entries {
+		before := m.movedAway(path)
+		if err := logger.Write(entry); err != nil {
+			t.Fatal(err)
+		}
+		if m.movedAway(path) != before {
+			rotations = append(rotations, i)
+		}
+	}
+	return rotations
+}
+
+// repeat returns n copies of entry
+func repeat(entry LogEntry, n int) []LogEntry {
+	entries := make([]LogEntry, n)
+	for i := range entries {
+		entries[i] = entry
+	}
+	return entries
+}
+
+// TestFileSinkRotationBySize drives size rotation through a Logger onto a memFS and checks
+// that it happens exactly when the file is full, and that each rotated file holds the entries
+// written between two rotations, in order
+func TestFileSinkRotationBySize(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+	entry := LogEntry{Level: LevelInfo, Service: "test", Message: "rotation"}
+
+	// Single-digit seqs keep every line the same length, so three fill a file exactly
+	stamped := entry
+	stamped.Timestamp, stamped.Seq = formatTimestamp(clock.Now()), 1
+	line, err := encodeEntry(stamped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lineSize := int64(len(line) + len(recordDelimiter()))
+
+	const path = "/logs/app.log"
+	m := newMemFS(clock)
+	logger := NewLogger(newFileSink(fileConfig{path: path, maxSize: 3 * lineSize, maxFiles: 5, naming: namingNumbered, clock: clock, fsys: m}), clock)
+	rotations := writeAndTrackRotations(t, logger, m, path, repeat(entry, 9))
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []int{3, 6}; len(rotations) != len(want) || rotations[0] != want[0] || rotations[1] != want[1] {
+		t.Errorf("rotated after %v entries, want %v", rotations, want)
+	}
+	if got, want := strings.Join(m.names(), " "), "app.log app.log.1 app.log.2"; got != want {
+		t.Errorf("files %s, want %s", got, want)
+	}
+	for name, want := range map[string][]int64{
+		path + ".2": seqRange(1, 3),
+		path + ".1": seqRange(4, 6),
+		path:        seqRange(7, 9),
+	} {
+		if got := m.seqs(t, name); !equalSeqs(got, want) {
+			t.Errorf("%s holds seqs %v, want %v", filepath.Base(name), got, want)
+		}
+	}
+}
+
+// TestFileSinkRotationByAge checks that -rotate-interval rotates on the first write once the
+// file is older than the interval, as told by the injected clock, and not before
+func TestFileSinkRotationByAge(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+	const path = "/logs/app.log"
+	m := newMemFS(clock)
+	logger := NewLogger(newFileSink(fileConfig{path: path, maxSize: 1 << 30, maxFiles: 5, interval: time.Hour, naming: namingNumbered, clock: clock, fsys: m}), clock)
+	entry := LogEntry{Level: LevelInfo, Service: "test", Message: "rotation"}
+
+	var rotations []int
+	for i, step := range []time.Duration{0, 30 * time.Minute, 29 * time.Minute, 2 * time.Minute, 10 * time.Minute} {
+		clock.advance(step)
+		if writeAndTrackRotations(t, logger, m, path, []LogEntry{entry}) != nil {
+			rotations = append(rotations, i)
+		}
+	}
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The fourth write comes 61 minutes after the file was started
+	if len(rotations) != 1 || rotations[0] != 3 {
+		t.Errorf("rotated after %v entries, want [3]", rotations)
+	}
+	if got, want := m.seqs(t, path+".1"), seqRange(1, 3); !equalSeqs(got, want) {
+		t.Errorf("app.log.1 holds seqs %v, want %v", got, want)
+	}
+	if got, want := m.seqs(t, path), seqRange(4, 5); !equalSeqs(got, want) {
+		t.Errorf("app.log holds seqs %v, want %v", got, want)
+	}
+}
+
+// TestFileSinkReopensMovedFile checks that once a file has been moved away by something else,
+// such as logrotate, the sink notices at its next path check and starts a fresh file, while
+// entries written before the check still land in the moved one
+func TestFileSinkReopensMovedFile(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+	const path = "/logs/app.log"
+	m := newMemFS(clock)
+	logger := NewLogger(newFileSink(fileConfig{path: path, maxSize: 1 << 30, maxFiles: 5, naming: namingNumbered, clock: clock, fsys: m}), clock)
+	entry := LogEntry{Level: LevelInfo, Service: "test", Message: "moved"}
+
+	write := func() {
+		t.Helper()
+		if err := logger.Write(entry); err != nil {
+			t.Fatal(err)
+		}
+		if err := logger.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write()
+	if err := m.Rename(path, path+".old"); err != nil {
+		t.Fatal(err)
+	}
+	write() // Before the next path check: still written to the open, moved file
+	clock.advance(statInterval)
+	write()
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := m.seqs(t, path+".old"), seqRange(1, 2); !equalSeqs(got, want) {
+		t.Errorf("app.log.old holds seqs %v, want %v", got, want)
+	}
+	if got, want := m.seqs(t, path), seqRange(3, 3); !equalSeqs(got, want) {
+		t.Errorf("app.log holds seqs %v, want %v", got, want)
+	}
+}
+
+// TestFileSinkKeepsMaxFiles rotates maxFiles+2 times and checks that exactly maxFiles rotated
+// files remain, numbered newest first, including where renaming onto an existing file fails
+func TestFileSinkKeepsMaxFiles(t *testing.T) {
+	const maxFiles = 3
+	for _, noReplace := range []bool{false, true} {
+		t.Run(fmt.Sprintf("noReplace=%v", noReplace), func(t *testing.T) {
+			clock := &fakeClock{now: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+			const path = "/logs/app.log"
+			m := newMemFS(clock)
+			m.noReplace = noReplace
+			// A limit of one byte rotates before every write but the first
+			logger := NewLogger(newFileSink(fileConfig{path: path, maxSize: 1, maxFiles: maxFiles, naming: namingNumbered, clock: clock, fsys: m}), clock)
+			entry := LogEntry{Level: LevelInfo, Service: "test", Message: "retention"}
+			rotations := writeAndTrackRotations(t, logger, m, path, repeat(entry, maxFiles+3))
+			if err := logger.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(rotations) != maxFiles+2 {
+				t.Fatalf("rotated %d times, want %d", len(rotations), maxFiles+2)
+			}
+			if got, want := strings.Join(m.names(), " "), "app.log app.log.1 app.log.2 app.log.3"; got != want {
+				t.Errorf("files %s, want %s", got, want)
+			}
+			// The last write went to app.log; each rotated file holds one of those before it
+			for i := 0; i <= maxFiles; i++ {
+				name := path
+				if i > 0 {
+					name = fmt.Sprintf("%s.%d", path, i)
+				}
+				if got, want := m.seqs(t, name), seqRange(int64(maxFiles+3-i), int64(maxFiles+3-i)); !equalSeqs(got, want) {
+					t.Errorf("%s holds seqs %v, want %v", filepath.Base(name), got, want)
+				}
+			}
+		})
+	}
+}
+
+// TestPruneTotalSize checks that -max-total-size removes rotated files oldest first, with
+// their .meta sidecars, until the rest fit, and never removes the newest
+func TestPruneTotalSize(t *testing.T) {
+	tests := []struct {
+		name  string
+		sizes map[string]int // Rotated file or sidecar suffix -> size
+		limit int64
+		want  string // Files left, sorted
+	}{
+		{"under the limit", map[string]int{".1": 10, ".2": 10, ".3": 10, ".3.meta": 2}, 30, "app.log.1 app.log.2 app.log.3 app.log.3.meta"},
+		{"over the limit", map[string]int{".1": 10, ".2": 10, ".3": 10, ".3.meta": 2}, 25, "app.log.1 app.log.2"},
+		{"gzipped files count as they are", map[string]int{".1.gz": 5, ".2": 10, ".3.gz": 5, ".3.meta": 2}, 15, "app.log.1.gz app.log.2"},
+		{"newest alone over the limit", map[string]int{".1": 40, ".2": 10}, 25, "app.log.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const path = "/logs/app.log"
+			m := newMemFS(&fakeClock{})
+			for suffix, size := range tt.sizes {
+				m.files[path+suffix] = bytes.NewBuffer(make([]byte, size))
+			}
+
+			s := newFileSink(fileConfig{path: path, maxFiles: 5, naming: namingNumbered, fsys: m})
+			pruneTotalSize(m, s.rotatedFiles(), tt.limit)
+			if got := strings.Join(m.names(), " "); got != tt.want {
+				t.Errorf("left %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestFileSinkRetentionBounds checks that -max-files and -max-total-size apply together,
+// whichever is stricter deciding how many rotated files are kept
+func TestFileSinkRetentionBounds(t *testing.T) {
+	entry := LogEntry{Level: LevelInfo, Service: "test", Message: "retention"}
+	stamped := entry
+	stamped.Timestamp, stamped.Seq = formatTimestamp(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)), 1
+	line, err := encodeEntry(stamped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lineSize := int64(len(line) + len(recordDelimiter())) // Every rotated file holds one line
+
+	tests := []struct {
+		name     string
+		maxFiles int
+		maxTotal int64
+		want     string
+	}{
+		{"max files stricter", 2, 10 * lineSize, "app.log app.log.1 app.log.2"},
+		{"total size stricter", 5, 3 * lineSize, "app.log app.log.1 app.log.2 app.log.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &fakeClock{now: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+			const path = "/logs/app.log"
+			m := newMemFS(clock)
+			logger := NewLogger(newFileSink(fileConfig{path: path, maxSize: 1, maxFiles: tt.maxFiles, maxTotal: tt.maxTotal, naming: namingNumbered, clock: clock, fsys: m}), clock)
+			writeAndTrackRotations(t, logger, m, path, repeat(entry, 7)) // Six rotations
+			if err := logger.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(m.names(), " "); got != tt.want {
+				t.Errorf("files %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestLoggerCloseWritesEverything checks that closing the Logger leaves every entry written
+// through it on disk, even those still buffered, and that later writes are refused
+func TestLoggerCloseWritesEverything(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	logger := NewLogger(newFileSink(fileConfig{path: path, maxSize: 1 << 30, maxFiles: 5, naming: namingNumbered}), realClock{})
+	const entries = 500
+	for i := 0; i < entries; i++ {
+		if err := logger.Write(LogEntry{Level: LevelInfo, Service: "test", Message: fmt.Sprintf("entry %d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := logger.Write(LogEntry{Level: LevelInfo, Service: "test", Message: "late"}); err != errLoggerClosed {
+		t.Errorf("write after Close = %v, want %v", err, errLoggerClosed)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != entries {
+		t.Fatalf("%d lines on disk, want %d", len(lines), entries)
+	}
+	for i, line := range lines {
+		var entry LogEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("line %d: %v in %q", i+1, err, line)
+		}
+		if want := fmt.Sprintf("entry %d", i); entry.Message != want {
+			t.Fatalf("line %d holds %q, want %q", i+1, entry.Message, want)
+		}
+	}
+}
+
+// BenchmarkFileSinkFsync measures the cost of each -fsync policy on the disk holding the
+// temporary directory; compare the entries/s of the sub-benchmarks
+func BenchmarkFileSinkFsync(b *testing.B) {
+	for _, policy := range []fsyncPolicy{
+		{mode: fsyncOff},
+		{mode: fsyncAlways},
+		{mode: fsyncInterval, every: 100 * time.Millisecond},
+	} {
+		b.Run(policy.String(), func(b *testing.B) {
+			s := newFileSink(fileConfig{path: filepath.Join(b.TempDir(), "app.log"), maxSize: 1 << 40, maxFiles: 1, naming: namingNumbered, fsync: policy})
+			entry := LogEntry{Timestamp: formatTimestamp(time.Now()), Level: LevelInfo, Service: "bench", Message: "fsync policy benchmark"}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := s.Write(entry); err != nil {
+					b.Fatal(err)
+				}
+			}
+			if err := s.Close(); err != nil {
+				b.Fatal(err)
+			}
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "entries/s")
+		})
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Supported output formats for serialized log entries
+const (
+	formatJSON   = "json"   // One JSON object per line (default)
+	formatLogfmt = "logfmt" // key=value pairs, quoting values where needed
+	formatPlain  = "plain"  // Human-readable single line
+	formatSyslog = "syslog" // RFC 5424 syslog message
+	formatECS    = "ecs"    // One Elastic Common Schema JSON document per line
+
+	formatJSONArray = "json-array" // A single JSON array per file, closed on rotation and shutdown
+)
+
+// Supported timestamp encodings for LogEntry.Timestamp
+const (
+	timestampRFC3339     = "rfc3339"     // 2006-01-02T15:04:05Z07:00 (default)
+	timestampRFC3339Nano = "rfc3339nano" // 2006-01-02T15:04:05.999999999Z07:00
+	timestampEpochMillis = "epoch_ms"    // Unix epoch milliseconds, as a JSON number
+	timestampEpochNanos  = "epoch_ns"    // Unix epoch nanoseconds, as a JSON number
+)
+
+// Record delimiters selectable with -delimiter, written after each serialized entry
+const (
+	delimiterNewline = "newline" // \n (default)
+	delimiterNull    = "null"    // \0, for collectors that split records on NUL
+	delimiterCRLF    = "crlf"    // \r\n
+)
+
+// Field-name casings selectable with -field-case
+const (
+	fieldCaseSnake = "snake" // response_time_ms, as in the JSON tags (default)
+	fieldCaseCamel = "camel" // responseTimeMs
+)
+
+var (
+	logFormat       = formatJSON       // How sinks serialize each LogEntry
+	timestampFormat = timestampRFC3339 // How Logger stamps each LogEntry
+	delimiter       = delimiterNewline // What separates serialized entries
+	fieldCase       = fieldCaseSnake   // How field names are spelled on output
+	maxLineBytes    = 0                // Longest serialized entry; longer ones are shortened (0 disables)
+)
+
+// validFormat reports whether name is a supported output format
+func validFormat(name string) bool {
+	switch name {
+	case formatJSON, formatLogfmt, formatPlain, formatSyslog, formatECS, formatJSONArray:
+		return true
+	}
+	return false
+}
+
+// validTimestampFormat reports whether name is a supported timestamp format
+func validTimestampFormat(name string) bool {
+	switch name {
+	case timestampRFC3339, timestampRFC3339Nano, timestampEpochMillis, timestampEpochNanos:
+		return true
+	}
+	return false
+}
+
+// recordDelimiter returns the bytes written after each entry for delimiter
+// json-array output is a single document and keeps its own newline layout
+func recordDelimiter() string {
+	switch delimiter {
+	case delimiterNull:
+		return "\x00"
+	case delimiterCRLF:
+		return "\r\n"
+	default:
+		return "\n"
+	}
+}
+
+// formatTimestamp encodes t according to timestampFormat
+// Epoch formats are returned as int64 so they marshal as JSON numbers
+func formatTimestamp(t time.Time) interface{} {
+	switch timestampFormat {
+	case timestampRFC3339Nano:
+		return t.Format(time.RFC3339Nano)
+	case timestampEpochMillis:
+		return t.UnixMilli()
+	case timestampEpochNanos:
+		return t.UnixNano()
+	default:
+		return t.Format(time.RFC3339)
+	}
+}
+
+// formatEntry serializes entry according to logFormat, without a trailing newline
+// For json-array this is a single array element; the sink adds the surrounding brackets
+func formatEntry(entry LogEntry) ([]byte, error) {
+	switch logFormat {
+	case formatLogfmt:
+		return []byte(formatLogfmtLine(entryFields(entry))), nil
+	case formatPlain:
+		return []byte(formatPlainLine(entry)), nil
+	case formatSyslog:
+		return []byte(formatSyslogLine(entry)), nil
+	case formatECS:
+		return formatECSDocument(entry)
+	default:
+		data, err := json.Marshal(entry)
+		if err != nil || fieldCase == fieldCaseSnake {
+			return data, err
+		}
+		return recaseJSON(data)
+	}
+}
+
+// formatEntryWithin serializes entry like formatEntry, shortening its stack trace and then its
+// message until the record fits in max bytes (0 means no limit). A shortened entry is marked
+// truncated; since the fields are cut before serializing, the record stays valid in any format
+// If the other fields alone are longer than max, the record is written over-long rather than lost
+func formatEntryWithin(entry LogEntry, max int) ([]byte, error) {
+	line, err := formatEntry(entry)
+	for err == nil && max > 0 && len(line) > max && (entry.StackTrace != "" || entry.Message != "") {
+		// Escaping only ever lengthens a value, so cutting excess raw bytes removes at least as many
+		// serialized ones; a further pass is needed only for the truncated marker itself
+		excess := len(line) - max
+		n := min(excess, len(entry.StackTrace))
+		entry.StackTrace = cutBytes(entry.StackTrace, n)
+		entry.Message = cutBytes(entry.Message, excess-n)
+		entry.Truncated = true
+		line, err = formatEntry(entry)
+	}
+	return line, err
+}
+
+// cutBytes drops at least n bytes from the end of s, without splitting a UTF-8 sequence
+func cutBytes(s string, n int) string {
+	if n <= 0 {
+		return s
+	}
+	if n >= len(s) {
+		return ""
+	}
+	end := len(s) - n
+	for end > 0 && !utf8.RuneStart(s[end]) {
+		end--
+	}
+	return s[:end]
+}
+
+// fieldKey spells the snake_case field name key in fieldCase
+// For a flattened map field such as attributes.tenant_id only the part before the dot changes:
+// attribute keys are labels chosen by the application and are written as given
+func fieldKey(key string) string {
+	if fieldCase != fieldCaseCamel {
+		return key
+	}
+	name, rest, nested := strings.Cut(key, ".")
+	parts := strings.Split(name, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	name = strings.Join(parts, "")
+	if nested {
+		return name + "." + rest
+	}
+	return name
+}
+
+// recaseJSON rewrites the top-level keys of the JSON object data with fieldKey, keeping
+// their order and leaving every value, including nested objects, byte for byte as it was
+func recaseJSON(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil { // Opening brace
+		return nil, err
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, '{')
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		key, _ := json.Marshal(fieldKey(tok.(string)))
+		if len(out) > 1 {
+			out = append(out, ',')
+		}
+		out = append(out, key...)
+		out = append(out, ':')
+		out = append(out, value...)
+	}
+	return append(out, '}'), nil
+}
+
+// entryField is a single named value taken from a LogEntry
+type entryField struct {
+	key   string
+	value interface{}
+}
+
+// entryFields lists the populated fields of entry in struct order, keyed by their JSON
+// names and honoring omitempty, so every format stays in step with the JSON schema
+// Map fields are flattened into one field per key, e.g. attributes.tenant_id, in key order
+func entryFields(entry LogEntry) []entryField {
+	v := reflect.ValueOf(entry)
+	t := v.Type()
+	fields := make([]entryField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, opts, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		if strings.Contains(opts, "omitempty") && v.Field(i).IsZero() {
+			continue
+		}
+		if attrs, ok := v.Field(i).Interface().(map[string]string); ok {
+			keys := make([]string, 0, len(attrs))
+			for k := range attrs {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				fields = append(fields, entryField{key: name + "." + k, value: attrs[k]})
+			}
+			continue
+		}
+		fields = append(fields, entryField{key: name, value: v.Field(i).Interface()})
+	}
+	return fields
+}
+
+// formatLogfmtLine renders fields as space-separated key=value pairs
+func formatLogfmtLine(fields []entryField) string {
+	var b strings.Builder
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(fieldKey(f.key))
+		b.WriteByte('=')
+		b.WriteString(logfmtValue(f.value))
+	}
+	return b.String()
+}
+
+// logfmtValue formats a single logfmt value, quoting it if it is empty or
+// contains spaces, quotes, '=' or control characters
+func logfmtValue(value interface{}) string {
+	s := fmt.Sprint(value)
+	if s == "" || strings.ContainsAny(s, " =\"\\") || strings.IndexFunc(s, func(r rune) bool { return r < 0x20 || r == 0x7f }) >= 0 {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// formatPlainLine renders entry as "<timestamp> <LEVEL> [<service>] <message>" followed by
+// any remaining fields in logfmt style
+func formatPlainLine(entry LogEntry) string {
+	var extra []entryField
+	for _, f := range entryFields(entry) {
+		switch f.key {
+		case "timestamp", "level", "service", "message":
+		default:
+			extra = append(extra, f)
+		}
+	}
+
+	// Escape newlines and other control characters so the record stays on one line
+	line := fmt.Sprintf("%v %-5s [%s] %s", entry.Timestamp, entry.Level, entry.Service, escapeControl(entry.Message))
+	if len(extra) > 0 {
+		line += " " + formatLogfmtLine(extra)
+	}
+	return line
+}
+
+// escapeControl escapes quotes, backslashes, newlines and other control characters Go-style,
+// without adding surrounding quotes
+func escapeControl(s string) string {
+	quoted := strconv.Quote(s)
+	return quoted[1 : len(quoted)-1]
+}
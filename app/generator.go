@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+)
+
+// Generator supplies the entries a generator worker writes, one at a time
+// Entries go through the same filtering, sampling, templating and annotation as the built-in
+// ones, so a Generator only fills in what makes each entry distinctive
+type Generator interface {
+	// Next returns the next entry to write, or false once there are no more; the worker then stops
+	Next() (LogEntry, bool)
+}
+
+// groupedGenerator is implemented by generators whose entries come in groups meant to be written
+// back to back, such as a request and the logs on its trace. Workers pause between groups
+// rather than after every entry
+type groupedGenerator interface {
+	Generator
+	// groupDone reports whether the entry last returned by Next was the last of its group
+	groupDone() bool
+}
+
+// newGenerator returns the Generator for one worker, drawing on rng and telling the time by clock
+// It is a variable so a fork can mix in its own entries without touching the worker loop
+var newGenerator = func(rng *rand.Rand, clock Clock) Generator {
+	return &randomGenerator{rng: rng, clock: clock}
+}
+
+// randomGenerator is the built-in Generator: endless iterations of randomIteration
+type randomGenerator struct {
+	rng     *rand.Rand
+	clock   Clock
+	pending []LogEntry // Rest of the current iteration
+}
+
+// Next implements Generator
+func (g *randomGenerator) Next() (LogEntry, bool) {
+	for len(g.pending) == 0 {
+		g.pending = randomIteration(g.rng, g.clock.Now())
+	}
+	entry := g.pending[0]
+	g.pending = g.pending[1:]
+	return entry, true
+}
+
+// groupDone implements groupedGenerator; each iteration is a group
+func (g *randomGenerator) groupDone() bool {
+	return len(g.pending) == 0
+}
+
+// writeIteration writes the next group of entries from gen, or a single entry if gen does not
+// group them. It returns how many were written, and false once gen has run out
+func writeIteration(ctx context.Context, logger *Logger, gen Generator) (int, bool) {
+	n := 0
+	for {
+		entry, ok := gen.Next()
+		if !ok {
+			return n, false
+		}
+		if emit(ctx, logger, entry) {
+			n++
+		}
+		if g, grouped := gen.(groupedGenerator); !grouped || g.groupDone() {
+			return n, true
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// updateGolden rewrites the golden files from the current output instead of comparing against them
+var updateGolden = flag.Bool("update", false, "rewrite testdata golden files")
+
+// TestGeneratorSeedGolden checks that a fixed -seed reproduces the same entries, so output
+// recorded for one seed can serve as a fixture. Changing what the generator draws, or in what
+// order, changes every entry after it; if that is intended, rerun with -update
+func TestGeneratorSeedGolden(t *testing.T) {
+	const entries = 12
+	golden := filepath.Join("testdata", "seed42.jsonl")
+
+	clock := &fakeClock{now: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+	gen := newGenerator(rand.New(rand.NewSource(42)), clock)
+	var got []string
+	for i := 0; i < entries; i++ {
+		entry, ok := gen.Next()
+		if !ok {
+			t.Fatalf("generator ran out after %d entries", i)
+		}
+		line, err := json.Marshal(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(line))
+	}
+
+	if *updateGolden {
+		if err := os.WriteFile(golden, []byte(strings.Join(got, "\n")+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	f, err := os.Open(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var want []string
+	scanner := bufio.NewScanner(f) // Drops a trailing \r too, so a CRLF checkout still matches
+	for scanner.Scan() {
+		want = append(want, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(want) != entries {
+		t.Fatalf("%s holds %d entries, want %d", golden, len(want), entries)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("entry %d:\n got %s\nwant %s", i+1, got[i], want[i])
+		}
+	}
+}
@@ -1,3 +1,5 @@
-module fluent-bit-interagtion-with-middlewareio
-
-go 1.22
\ No newline at end of file
+module fluent-bit-interagtion-with-middlewareio
+
+go 1.22
+
+require gopkg.in/yaml.v3 v3.0.1
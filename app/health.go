@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Health endpoint configuration
+var (
+	healthAddr       = ""               // Listen address of /healthz and /readyz (empty disables them)
+	healthStaleAfter = 30 * time.Second // /healthz fails once no entry has been written for this long
+)
+
+// registerHealth adds the liveness and readiness probes for logger to mux
+//
+//	/healthz is 200 while writes keep succeeding, and 503 once the last write failed or
+//	         none has happened within healthStaleAfter (e.g. the generation loop is stuck)
+//	/readyz  is 200 once the output is open, i.e. after the first successful write
+func registerHealth(mux *http.ServeMux, logger *Logger) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		st := logger.status()
+		now := logger.clock.Now()
+		since := st.lastWrite
+		if since.IsZero() {
+			since = st.started // Give the first write the same grace period as any other
+		}
+		switch {
+		case st.lastErr != nil:
+			http.Error(w, fmt.Sprintf("unhealthy: last write failed: %v", st.lastErr), http.StatusServiceUnavailable)
+		case now.Sub(since) > healthStaleAfter:
+			http.Error(w, fmt.Sprintf("unhealthy: no entry written for %s", now.Sub(since).Round(time.Second)), http.StatusServiceUnavailable)
+		default:
+			fmt.Fprintln(w, "ok")
+		}
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if logger.status().lastWrite.IsZero() {
+			http.Error(w, "not ready: output not open yet", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+}
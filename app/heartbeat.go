@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// heartbeatInterval is how often a heartbeat entry is written (0 disables)
+var heartbeatInterval = time.Duration(0)
+
+// heartbeat writes an INFO heartbeat entry every interval until ctx is done, independent of
+// the random generation, with Sequence counting up from 1. A gap in the sequence or in the
+// entries themselves shows when the generator stopped, for demoing "no data received" alerts
+// Like other entries, heartbeats count towards -max-entries
+func heartbeat(ctx context.Context, logger *Logger, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	var sequence int64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if !reserveEntry() {
+			return
+		}
+		sequence++
+		entry := LogEntry{
+			Level:     LevelInfo,
+			Service:   "log-generator",
+			Component: "heartbeat",
+			Message:   fmt.Sprintf("Heartbeat %d", sequence), // Distinct messages, so -dedup-window never collapses them
+			Sequence:  sequence,
+		}
+		if region != regionRandom {
+			entry.Region = region
+		}
+		annotate(&entry)
+		submit(ctx, logger, entry)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HTTP output configuration (-output=http)
+var (
+	httpEndpoint      = ""              // URL batches are POSTed to
+	httpAPIKey        = ""              // Sent in httpAPIKeyHeader on every request
+	httpAPIKeyHeader  = "Authorization" // Header carrying the API key
+	httpBatchSize     = 100             // Send once this many entries are pending
+	httpFlushInterval = 5 * time.Second // Send pending entries at least this often
+	httpMaxRetries    = 5               // Retries per batch on network errors and 5xx responses
+)
+
+// httpShutdownTimeout bounds how long shutdown waits for the final batches to be delivered
+const httpShutdownTimeout = 10 * time.Second
+
+// httpSink batches entries and POSTs each batch to endpoint, as a JSON array for -output=http
+// or as an OTLP export request for -output=otlp
+// Sending happens on a background goroutine so a slow endpoint only blocks writers
+// once a full batch is already waiting
+type httpSink struct {
+	client   *http.Client
+	endpoint string
+	header   http.Header                               // Sent with every request, Content-Type included
+	encode   func(LogEntry) (batchRecord, error)       // Serializes one entry on Write
+	body     func(batch []batchRecord) ([]byte, error) // Builds a request body from a batch
+
+	mu      sync.Mutex
+	pending []batchRecord
+
+	// flushMu keeps batches in order when the flush ticker and a full batch race
+	flushMu sync.Mutex
+
+	batches   chan []batchRecord
+	done      chan struct{} // Closed once sendLoop has drained batches
+	stop      chan struct{} // Closed to stop flushLoop
+	flushDone chan struct{} // Closed once flushLoop has returned
+
+	// ctx is cancelled when shutdown gives up on delivery, aborting in-flight requests and backoff
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// batchRecord is one serialized entry waiting in an httpSink batch
+type batchRecord struct {
+	data     json.RawMessage
+	resource string // What produced the entry, for request formats that group entries by it
+}
+
+// startHTTPSink starts a sink POSTing JSON arrays of entries to httpEndpoint
+func startHTTPSink() *httpSink {
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	if httpAPIKey != "" {
+		header.Set(httpAPIKeyHeader, httpAPIKey)
+	}
+	return startBatchSink(httpEndpoint, header, encodeJSONRecord, jsonArrayBody)
+}
+
+// encodeJSONRecord serializes entry as JSON, whatever -format says
+func encodeJSONRecord(entry LogEntry) (batchRecord, error) {
+	data, err := json.Marshal(entry)
+	return batchRecord{data: data}, err
+}
+
+// jsonArrayBody joins batch into a single JSON array
+func jsonArrayBody(batch []batchRecord) ([]byte, error) {
+	records := make([]json.RawMessage, len(batch))
+	for i, r := range batch {
+		records[i] = r.data
+	}
+	return json.Marshal(records)
+}
+
+// startBatchSink starts the sender and periodic flush goroutines of a sink POSTing batches
+// built by body to endpoint
+func startBatchSink(endpoint string, header http.Header, encode func(LogEntry) (batchRecord, error), body func([]batchRecord) ([]byte, error)) *httpSink {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &httpSink{
+		client:    &http.Client{Timeout: 30 * time.Second},
+		endpoint:  endpoint,
+		header:    header,
+		encode:    encode,
+		body:      body,
+		batches:   make(chan []batchRecord, 1),
+		done:      make(chan struct{}),
+		stop:      make(chan struct{}),
+		flushDone: make(chan struct{}),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	go s.sendLoop()
+	go s.flushLoop()
+	return s
+}
+
+// Write implements Sink
+// Batches are never in -format's encoding, but in the one the endpoint expects
+func (s *httpSink) Write(entry LogEntry) error {
+	record, err := s.encode(entry)
+	if err != nil {
+		return fmt.Errorf("serialize %s log entry: %w", entry.Level, err)
+	}
+	s.add(record)
+	logBytesWritten.Add(int64(len(record.data)))
+	return nil
+}
+
+// add queues one serialized entry, handing off a batch once httpBatchSize is reached
+func (s *httpSink) add(record batchRecord) {
+	s.mu.Lock()
+	s.pending = append(s.pending, record)
+	full := len(s.pending) >= httpBatchSize
+	s.mu.Unlock()
+	if full {
+		s.flush()
+	}
+}
+
+// Flush implements Sink, handing off pending entries without waiting for delivery
+func (s *httpSink) Flush() error {
+	s.flush()
+	return nil
+}
+
+// flush hands off any pending entries to the sender
+func (s *httpSink) flush() {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	batch := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+	if len(batch) > 0 {
+		s.batches <- batch
+	}
+}
+
+// flushLoop sends partial batches every httpFlushInterval so quiet periods still deliver
+func (s *httpSink) flushLoop() {
+	defer close(s.flushDone)
+	ticker := time.NewTicker(httpFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.flush()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// sendLoop delivers batches in order until the batch channel is closed
+func (s *httpSink) sendLoop() {
+	defer close(s.done)
+	for batch := range s.batches {
+		if err := s.send(batch); err != nil {
+			logWriteErrors.Add(int64(len(batch)))
+			log.Printf("warning: dropped batch of %d log entries: %v", len(batch), err)
+		}
+	}
+}
+
+// send POSTs batch, retrying network errors and 5xx responses with exponential backoff
+// 4xx responses are not retried since resending the same payload won't help
+func (s *httpSink) send(batch []batchRecord) error {
+	body, err := s.body(batch)
+	if err != nil {
+		return err
+	}
+
+	backoff := 500 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		err = s.post(body)
+		if err == nil {
+			return nil
+		}
+		if _, permanent := err.(permanentError); permanent || attempt >= httpMaxRetries {
+			return err
+		}
+		log.Printf("warning: sending %d log entries failed (attempt %d), retrying in %s: %v", len(batch), attempt+1, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-s.ctx.Done():
+			return s.ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// permanentError marks a failure that retrying will not fix
+type permanentError struct{ error }
+
+// post performs a single POST of body to the endpoint
+func (s *httpSink) post(body []byte) error {
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return permanentError{err}
+	}
+	req.Header = s.header.Clone()
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) // Drain so the connection can be reused
+
+	switch {
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("%s: %s", s.endpoint, resp.Status)
+	case resp.StatusCode >= 300:
+		return permanentError{fmt.Errorf("%s: %s", s.endpoint, resp.Status)}
+	}
+	return nil
+}
+
+// Close implements Sink, sending any pending entries and waiting for delivery,
+// giving up after httpShutdownTimeout
+func (s *httpSink) Close() error {
+	deadline := time.After(httpShutdownTimeout)
+	close(s.stop)
+	<-s.flushDone // No more ticker flushes once the batch channel is closed
+
+	// The final flush waits for room in batches, so it too must give way to the deadline
+	// while sendLoop is retrying an earlier batch
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		s.flush()
+		close(s.batches)
+		<-s.done
+	}()
+
+	select {
+	case <-finished:
+		s.cancel()
+		return nil
+	case <-deadline:
+		s.cancel() // Abort the in-flight request and any backoff wait
+		<-finished
+		return fmt.Errorf("timed out after %s delivering final log batches", httpShutdownTimeout)
+	}
+}
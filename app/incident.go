@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"time"
+)
+
+// Incident simulation configuration (-incident-every, -incident-duration)
+var (
+	incidentEvery    = time.Duration(0) // Start an incident on this schedule (0 only starts them on SIGUSR1)
+	incidentDuration = time.Minute      // How long each incident lasts
+
+	// Level mix of component health logs during an incident, replacing levelWeights
+	incidentWeights = weightedLevels{{LevelError, 80}, {LevelWarn, 15}, {LevelInfo, 5}}
+)
+
+// incidentErrorRatio is the share of API requests that fail with a 5xx during an incident
+const incidentErrorRatio = 0.8
+
+// incidentUntil is when the current incident ends, in Unix nanoseconds (0 when none has run)
+var incidentUntil atomic.Int64
+
+// inIncident reports whether an incident is in progress at now
+func inIncident(now time.Time) bool {
+	return now.UnixNano() < incidentUntil.Load()
+}
+
+// watchIncidents starts an incident every incidentEvery and whenever one of incidentSignals
+// arrives, until ctx is done. Starting one while another is running extends it
+func watchIncidents(ctx context.Context, clock Clock) {
+	trigger := make(chan os.Signal, 1)
+	if sigs := incidentSignals(); len(sigs) > 0 {
+		signal.Notify(trigger, sigs...)
+		defer signal.Stop(trigger)
+	}
+	var schedule <-chan time.Time
+	if incidentEvery > 0 {
+		t := time.NewTicker(incidentEvery)
+		defer t.Stop()
+		schedule = t.C
+	}
+
+	var over <-chan time.Time // Fires when the current incident ends
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-trigger:
+			over = startIncident(clock, "on demand")
+		case <-schedule:
+			over = startIncident(clock, "on schedule")
+		case <-over:
+			over = nil
+			log.Println("Incident resolved, error rate back to normal")
+		}
+	}
+}
+
+// startIncident raises the error rate for incidentDuration from now, returning a channel
+// that fires once it is over
+func startIncident(clock Clock, why string) <-chan time.Time {
+	incidentUntil.Store(clock.Now().Add(incidentDuration).UnixNano())
+	log.Printf("Incident started %s: raising the error rate to about %.0f%% for %s", why, incidentErrorRatio*100, incidentDuration)
+	return time.After(incidentDuration)
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// incidentSignals are the signals that start an incident on demand
+func incidentSignals() []os.Signal {
+	return []os.Signal{syscall.SIGUSR1}
+}
@@ -0,0 +1,9 @@
+package main
+
+import "os"
+
+// incidentSignals are the signals that start an incident on demand
+// Windows has no SIGUSR1, so incidents only follow -incident-every there
+func incidentSignals() []os.Signal {
+	return nil
+}
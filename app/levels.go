@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Level is the severity of a log entry, written as its name, e.g. "WARN"
+// Every level the generator emits or accepts in configuration is one of the constants below,
+// so a typo such as "WARNING" fails at startup instead of producing entries no query matches
+type Level string
+
+// Supported levels, lowest first
+const (
+	LevelDebug Level = "DEBUG"
+	LevelInfo  Level = "INFO"
+	LevelWarn  Level = "WARN"
+	LevelError Level = "ERROR"
+)
+
+// levels lists the supported levels, lowest first
+var levels = []Level{LevelDebug, LevelInfo, LevelWarn, LevelError}
+
+// parseLevel returns the level named by name, ignoring case, or an error listing the valid ones
+func parseLevel(name string) (Level, error) {
+	level := Level(strings.ToUpper(strings.TrimSpace(name)))
+	if severityNumber(level) == 0 {
+		return "", fmt.Errorf("unknown level %q: must be one of %s", name, levelNames(levels))
+	}
+	return level, nil
+}
+
+// levelNames renders list for messages, e.g. "DEBUG, INFO, WARN or ERROR"
+func levelNames(list []Level) string {
+	names := make([]string, len(list))
+	for i, level := range list {
+		names[i] = string(level)
+	}
+	if len(names) < 2 {
+		return strings.Join(names, "")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
+
+// severityNumber maps a level to the base SeverityNumber of its range in the OpenTelemetry
+// log data model (DEBUG 5-8, INFO 9-12, WARN 13-16, ERROR 17-20)
+func severityNumber(level Level) int {
+	switch level {
+	case LevelDebug:
+		return 5
+	case LevelInfo:
+		return 9
+	case LevelWarn:
+		return 13
+	case LevelError:
+		return 17
+	}
+	return 0 // SEVERITY_NUMBER_UNSPECIFIED
+}
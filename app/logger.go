@@ -0,0 +1,368 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sink is a destination for log entries: a rotating file, stdout, an HTTP endpoint, ...
+// Sinks need not be safe for concurrent use, since Logger serializes all calls
+type Sink interface {
+	// Write delivers one entry; a non-nil error means the entry was lost
+	Write(entry LogEntry) error
+	// Flush pushes any buffered entries out to the destination
+	Flush() error
+	// Close flushes anything still buffered and releases the destination
+	Close() error
+}
+
+// Logger stamps and validates entries, then hands them to its sink one at a time
+type Logger struct {
+	mu     sync.Mutex
+	sink   Sink
+	clock  Clock // Stamps entries and paces the generators writing through this Logger
+	closed bool  // Set by Close; later writes fail rather than reach a closed sink
+	seq    int64 // Last sequence number handed out
+
+	// Outcome of the latest write, for health checks. It has its own lock so a probe
+	// never waits behind a slow write
+	stateMu   sync.Mutex
+	started   time.Time
+	lastWrite time.Time // Last successful write; zero until the first
+	lastErr   error     // Error of the latest write, nil once one succeeds again
+}
+
+// loggerStatus is a snapshot of a Logger's write state
+type loggerStatus struct {
+	started   time.Time
+	lastWrite time.Time
+	lastErr   error
+}
+
+// NewLogger returns a Logger writing to sink, telling the time by clock
+func NewLogger(sink Sink, clock Clock) *Logger {
+	return &Logger{sink: sink, clock: clock, started: clock.Now()}
+}
+
+// status returns the current write state
+func (l *Logger) status() loggerStatus {
+	l.stateMu.Lock()
+	defer l.stateMu.Unlock()
+	return loggerStatus{started: l.started, lastWrite: l.lastWrite, lastErr: l.lastErr}
+}
+
+// recordWrite updates the write state with the outcome of a write
+func (l *Logger) recordWrite(err error) {
+	l.stateMu.Lock()
+	defer l.stateMu.Unlock()
+	l.lastErr = err
+	if err == nil {
+		l.lastWrite = l.clock.Now()
+	}
+}
+
+// Write timestamps entry and passes it to the sink
+// It is safe for concurrent use: each call delivers one whole entry before the next starts
+// A non-nil error means the entry was lost; the caller decides whether to carry on
+func (l *Logger) Write(entry LogEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return errLoggerClosed
+	}
+
+	entry.Timestamp = formatTimestamp(l.clock.Now())
+	// Numbered under the lock, so numbers follow the order entries reach the sink. A failed
+	// write still uses up its number, leaving the same gap a consumer sees for entries lost later
+	// on, but a repeat folded into an earlier entry hands its number back: it is not lost, it is
+	// counted in that entry's repeat_count
+	l.seq++
+	entry.Seq = l.seq
+
+	// Report drift between what the generator emits and what the pipeline expects
+	// Invalid entries are still written, since the point is to surface the mismatch downstream too
+	if entrySchema != nil {
+		if errs := validateEntry(entrySchema, entry); len(errs) > 0 {
+			logSchemaErrors.Add(1)
+			log.Printf("warning: %s log entry does not match schema: %s", entry.Level, strings.Join(errs, "; "))
+		}
+	}
+
+	// Redact last, so the schema above still sees the entry as generated
+	if redactor != nil {
+		redactor.apply(&entry)
+	}
+
+	err := l.sink.Write(entry)
+	l.recordWrite(err)
+	if err != nil {
+		logWriteErrors.Add(1)
+		return err
+	}
+	if a, ok := l.sink.(absorber); ok && a.absorbed() {
+		l.seq--
+	}
+	logsGenerated.inc(entry.Level)
+	return nil
+}
+
+// reopener is implemented by sinks that can let go of their output and reacquire it,
+// such as a file moved aside by logrotate
+type reopener interface {
+	Reopen() error
+}
+
+// absorber is implemented by sinks that may fold an entry into an earlier one rather than
+// write it, such as the -dedup-window sink
+type absorber interface {
+	// absorbed reports whether the latest successful Write folded its entry into an earlier one
+	absorbed() bool
+}
+
+// Reopen flushes and reopens the sink's output, if it has one to reopen
+func (l *Logger) Reopen() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if r, ok := l.sink.(reopener); ok {
+		return r.Reopen()
+	}
+	return nil
+}
+
+// Flush flushes the sink; it is a no-op once the Logger is closed
+func (l *Logger) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	return l.sink.Flush()
+}
+
+// flushPeriodically flushes logger every interval until ctx is done, so buffered entries
+// reach the output within interval even when no further writes come along to flush them
+// Flushes take the write lock, so they never interleave with a write or a rotation
+func flushPeriodically(ctx context.Context, logger *Logger, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if err := logger.Flush(); err != nil {
+			log.Printf("warning: periodic flush failed: %v", err)
+		}
+	}
+}
+
+// errLoggerClosed is returned by writes after Close
+var errLoggerClosed = errors.New("logger is closed")
+
+// Close flushes, syncs and closes the sink, so every entry written so far reaches its
+// destination. Every exit path of the generator calls it; only the first call has any effect
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	return l.sink.Close()
+}
+
+// encodeEntry serializes entry in the configured format
+// Never emit a blank or partial line: if entry cannot be serialized it is replaced with a
+// diagnostic that downstream parsers can still read, and the original counts as a failed write
+func encodeEntry(entry LogEntry) ([]byte, error) {
+	line, err := formatEntryWithin(entry, maxLineBytes)
+	if err == nil {
+		return chaos(line), nil
+	}
+	logWriteErrors.Add(1)
+	log.Printf("warning: failed to serialize %s log entry: %v", entry.Level, err)
+	timestamp := entry.Timestamp
+	if _, terr := json.Marshal(timestamp); terr != nil {
+		timestamp = formatTimestamp(time.Now()) // The timestamp may be what failed to serialize
+	}
+	entry = LogEntry{
+		Timestamp:      timestamp,
+		Level:          LevelError,
+		SeverityNumber: severityNumber(LevelError),
+		Service:        entry.Service,
+		Message:        fmt.Sprintf("failed to serialize log entry: %v", err),
+		Component:      "log-writer",
+		Hostname:       entry.Hostname,
+		PodName:        entry.PodName,
+	}
+	if line, err = formatEntry(entry); err != nil {
+		return nil, fmt.Errorf("serialize diagnostic entry: %w", err)
+	}
+	return line, nil
+}
+
+// flushInterval bounds how long a written entry may sit in the buffer before reaching its destination
+var flushInterval = time.Second
+
+// writerSink writes formatted entries to any io.Writer, e.g. stdout, or a bytes.Buffer in tests
+// Entries are buffered and flushed at most flushEvery apart, and always on Close
+type writerSink struct {
+	out        io.Writer
+	w          *bufio.Writer
+	flushEvery time.Duration
+	lastFlush  time.Time
+
+	// arrayEntries counts entries in the open json-array document, or is -1 before its "[" is written
+	arrayEntries int
+
+	written int64 // Bytes handed to w so far, flushed or not, including json-array punctuation
+}
+
+// newWriterSink returns a sink writing to out, flushing every flushInterval
+func newWriterSink(out io.Writer) *writerSink {
+	return &writerSink{
+		out:          out,
+		w:            bufio.NewWriter(fullWriter{out}),
+		flushEvery:   flushInterval,
+		lastFlush:    time.Now(),
+		arrayEntries: -1,
+	}
+}
+
+// fullWriter retries short writes, for writers that may accept only part of a buffer without
+// reporting an error. *os.File already does this itself, but bufio.Writer would otherwise give
+// up with io.ErrShortWrite after writing part of a record, leaving it cut short in the output
+type fullWriter struct {
+	w io.Writer
+}
+
+// Write implements io.Writer; it only returns n < len(p) along with an error, and reports
+// io.ErrShortWrite if the underlying writer stops making progress
+func (f fullWriter) Write(p []byte) (int, error) {
+	total := 0
+	for total < len(p) {
+		n, err := f.w.Write(p[total:])
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if n == 0 {
+			return total, io.ErrShortWrite
+		}
+	}
+	return total, nil
+}
+
+// Write implements Sink
+func (s *writerSink) Write(entry LogEntry) error {
+	line, err := encodeEntry(entry)
+	if err != nil {
+		return err
+	}
+	return s.writeLine(line)
+}
+
+// writeLine writes one serialized entry, adding the newline or json-array punctuation
+func (s *writerSink) writeLine(line []byte) error {
+	if logFormat == formatJSONArray {
+		if s.arrayEntries < 0 {
+			s.w.WriteString("[\n") // First entry opens the array
+			s.written += 2
+			s.arrayEntries = 0
+		}
+		// Array elements are separated by commas; the closing bracket is written by Close
+		if s.arrayEntries > 0 {
+			line = append([]byte(",\n"), line...)
+		}
+		s.arrayEntries++
+	} else {
+		line = append(line, recordDelimiter()...)
+	}
+	if _, err := s.w.Write(line); err != nil {
+		s.reset()
+		return fmt.Errorf("write log entry: %w", err)
+	}
+	s.written += int64(len(line))
+	logBytesWritten.Add(int64(len(line)))
+
+	// Flush periodically rather than per entry to save write syscalls
+	if time.Since(s.lastFlush) >= s.flushEvery {
+		return s.Flush()
+	}
+	return nil
+}
+
+// Flush implements Sink
+func (s *writerSink) Flush() error {
+	s.lastFlush = time.Now()
+	if err := s.w.Flush(); err != nil {
+		s.reset()
+		return fmt.Errorf("flush log output: %w", err)
+	}
+	if f, ok := s.out.(interface{ Flush() error }); ok {
+		// A compressing writer holds data back too; flushing it ends a block the reader can decode
+		if err := f.Flush(); err != nil {
+			return fmt.Errorf("flush log output: %w", err)
+		}
+	}
+	return nil
+}
+
+// reset drops buffered output after an I/O error
+// bufio.Writer errors are sticky, so later writes need a fresh buffer to have any chance
+func (s *writerSink) reset() {
+	s.w.Reset(s.out)
+}
+
+// buffered returns the number of bytes written but not yet flushed
+func (s *writerSink) buffered() int {
+	return s.w.Buffered()
+}
+
+// Close implements Sink, closing any open json-array document and flushing
+// The underlying writer is left open
+func (s *writerSink) Close() error {
+	if logFormat == formatJSONArray && s.arrayEntries >= 0 {
+		// Close the array so every rotated file (and stdout) is a complete JSON document
+		if s.arrayEntries > 0 {
+			s.w.WriteString("\n")
+			s.written++
+		}
+		s.w.WriteString("]\n")
+		s.written += 2
+		s.arrayEntries = -1
+	}
+	return s.w.Flush()
+}
+
+// gzipSink is a writerSink whose output is a gzip stream, for -compress-stdout
+type gzipSink struct {
+	*writerSink
+	zw *gzip.Writer
+}
+
+// newGzipSink returns a sink writing a gzip stream to out
+func newGzipSink(out io.Writer) *gzipSink {
+	zw := gzip.NewWriter(out)
+	return &gzipSink{writerSink: newWriterSink(zw), zw: zw}
+}
+
+// Close implements Sink, flushing and then ending the gzip stream with its trailer
+// The underlying writer is left open
+func (s *gzipSink) Close() error {
+	err := s.writerSink.Close()
+	if cerr := s.zw.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestLoggerConcurrentWrites writes through one Logger from many goroutines while the file
+// rotates underneath, and checks that every entry comes out as one whole line, exactly once,
+// with seqs in file order and each goroutine's entries in the order it wrote them
+// Run it with -race to also catch unsynchronized access to the sink
+func TestLoggerConcurrentWrites(t *testing.T) {
+	const workers, perWorker = 16, 200
+
+	path := filepath.Join(t.TempDir(), "app.log")
+	logger := NewLogger(newFileSink(fileConfig{path: path, maxSize: 16 << 10, maxFiles: 1000, naming: namingNumbered}), realClock{})
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				entry := LogEntry{Level: LevelInfo, Service: fmt.Sprintf("worker-%d", w), Message: fmt.Sprintf("entry %d", i)}
+				if err := logger.Write(entry); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Oldest first: the highest numbered rotated file down to the active one
+	files := []string{path}
+	for n := 1; exists(fmt.Sprintf("%s.%d", path, n)); n++ {
+		files = append([]string{fmt.Sprintf("%s.%d", path, n)}, files...)
+	}
+	if len(files) < 2 {
+		t.Fatalf("expected the file to rotate during the test, found only %v", files)
+	}
+
+	var seq int64
+	next := map[string]int{} // Next entry expected from each worker
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var entry LogEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				t.Fatalf("%s: corrupt line %q: %v", filepath.Base(name), scanner.Text(), err)
+			}
+			seq++
+			if entry.Seq != seq {
+				t.Fatalf("%s: seq %d where %d was expected", filepath.Base(name), entry.Seq, seq)
+			}
+			if want := fmt.Sprintf("entry %d", next[entry.Service]); entry.Message != want {
+				t.Fatalf("%s: %s wrote %q where %q was expected", filepath.Base(name), entry.Service, entry.Message, want)
+			}
+			next[entry.Service]++
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if seq != workers*perWorker {
+		t.Errorf("found %d entries, want %d", seq, workers*perWorker)
+	}
+}
+
+// shortWriter accepts at most chunk bytes per call without reporting an error, as some
+// writers do, until limit bytes have been written in all; after that it fails with err, or
+// makes no progress if err is nil
+type shortWriter struct {
+	buf   bytes.Buffer
+	chunk int
+	limit int
+	err   error
+}
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	room := w.limit - w.buf.Len()
+	if room <= 0 {
+		return 0, w.err
+	}
+	n := min(len(p), w.chunk, room)
+	w.buf.Write(p[:n])
+	return n, nil
+}
+
+// TestFullWriter checks that fullWriter carries on through short writes and reports what
+// stopped it otherwise, with the count of bytes that did get through
+func TestFullWriter(t *testing.T) {
+	errBroken := errors.New("broken")
+	data := []byte("0123456789abcdefghij")
+
+	tests := []struct {
+		name    string
+		w       *shortWriter
+		wantN   int
+		wantErr error
+	}{
+		{"everything at once", &shortWriter{chunk: 64, limit: 64}, 20, nil},
+		{"a few bytes per call", &shortWriter{chunk: 3, limit: 64}, 20, nil},
+		{"stops making progress", &shortWriter{chunk: 3, limit: 8}, 8, io.ErrShortWrite},
+		{"fails part way", &shortWriter{chunk: 3, limit: 8, err: errBroken}, 8, errBroken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := fullWriter{tt.w}.Write(data)
+			if n != tt.wantN || !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Write = %d, %v; want %d, %v", n, err, tt.wantN, tt.wantErr)
+			}
+			if got := tt.w.buf.String(); got != string(data[:n]) {
+				t.Errorf("wrote %q, want %q", got, data[:n])
+			}
+		})
+	}
+}
+
+// TestWriterSinkShortWrites checks that entries reach a writer taking a few bytes at a time
+// as whole lines, where bufio.Writer alone would stop at the first short write
+func TestWriterSinkShortWrites(t *testing.T) {
+	w := &shortWriter{chunk: 7, limit: 1 << 20}
+	sink := newWriterSink(w)
+	for i := 0; i < 50; i++ {
+		if err := sink.Write(LogEntry{Level: LevelInfo, Service: "test", Message: fmt.Sprintf("entry %d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	scanner := bufio.NewScanner(&w.buf)
+	i := 0
+	for ; scanner.Scan(); i++ {
+		var entry LogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("line %d: %v in %q", i+1, err, scanner.Text())
+		}
+		if want := fmt.Sprintf("entry %d", i); entry.Message != want {
+			t.Fatalf("line %d holds %q, want %q", i+1, entry.Message, want)
+		}
+	}
+	if i != 50 {
+		t.Errorf("found %d lines, want 50", i)
+	}
+}
+
+// TestEncodeEntryFallback checks that an entry which cannot be serialized comes out as a
+// readable ERROR diagnostic, never a blank or partial line, and counts as a failed write
+func TestEncodeEntryFallback(t *testing.T) {
+	tests := []struct {
+		name      string
+		timestamp interface{}
+	}{
+		{"unserializable timestamp", func() {}},
+		{"unserializable number", math.Inf(1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			sink := newWriterSink(&buf)
+			errorsBefore := logWriteErrors.Load()
+			if err := sink.Write(LogEntry{Timestamp: tt.timestamp, Level: LevelInfo, Service: "checkout", Message: "order placed"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := sink.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := logWriteErrors.Load() - errorsBefore; got != 1 {
+				t.Errorf("log_write_errors_total went up by %d, want 1", got)
+			}
+			line := strings.TrimSuffix(buf.String(), "\n")
+			var entry LogEntry
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				t.Fatalf("diagnostic %q is not JSON: %v", line, err)
+			}
+			if entry.Level != LevelError || entry.Service != "checkout" || !strings.HasPrefix(entry.Message, "failed to serialize log entry: ") {
+				t.Errorf("diagnostic is %s %s %q, want ERROR checkout \"failed to serialize log entry: ...\"", entry.Level, entry.Service, entry.Message)
+			}
+			if entry.Timestamp == nil {
+				t.Error("diagnostic has no timestamp")
+			}
+		})
+	}
+}
+
+// countingWriter counts the Write calls that reach it, each of which would be a syscall on a file
+type countingWriter struct {
+	writes int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return len(p), nil
+}
+
+// BenchmarkWriterSinkFlush compares the write calls reaching the output when the buffer is
+// flushed after every entry with flushing at most every -flush-interval, as writerSink does
+func BenchmarkWriterSinkFlush(b *testing.B) {
+	for _, bench := range []struct {
+		name  string
+		every time.Duration
+	}{
+		{"per-entry", 0},
+		{"per-interval", time.Second},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			out := &countingWriter{}
+			sink := newWriterSink(out)
+			sink.flushEvery = bench.every
+			entry := LogEntry{Timestamp: formatTimestamp(time.Now()), Level: LevelInfo, Service: "bench", Message: "flush benchmark"}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := sink.Write(entry); err != nil {
+					b.Fatal(err)
+				}
+			}
+			if err := sink.Close(); err != nil {
+				b.Fatal(err)
+			}
+			b.ReportMetric(float64(out.writes)/float64(b.N), "writes/entry")
+		})
+	}
+}
+
+// BenchmarkFileSinkStats counts the stat calls a fileSink makes per entry: the file's size is
+// tracked in memory, so the path is only checked every statInterval rather than on each write
+func BenchmarkFileSinkStats(b *testing.B) {
+	clock := &fakeClock{now: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+	m := newMemFS(clock)
+	s := newFileSink(fileConfig{path: "/logs/app.log", maxSize: 1 << 40, maxFiles: 1, naming: namingNumbered, clock: clock, fsys: m})
+	entry := LogEntry{Timestamp: formatTimestamp(clock.Now()), Level: LevelInfo, Service: "bench", Message: "stat benchmark"}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		clock.advance(time.Millisecond) // A steady 1000 entries/s
+		if err := s.Write(entry); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(m.stats)/float64(b.N), "stats/entry")
+}
+
+// BenchmarkLoggerWrite measures entries/s through Logger.Write: to a discarding writer, for
+// the cost of stamping and encoding alone, to a file held open as fileSink does, and to a file
+// reopened for every entry, the way entries used to be written
+func BenchmarkLoggerWrite(b *testing.B) {
+	for _, bench := range []struct {
+		name   string
+		sink   func(b *testing.B) Sink
+		reopen bool
+	}{
+		{"discard", func(*testing.B) Sink { return newWriterSink(io.Discard) }, false},
+		{"file", benchFileSink, false},
+		{"file-reopened-per-entry", benchFileSink, true},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			sink := bench.sink(b)
+			logger := NewLogger(sink, realClock{})
+			entry := LogEntry{Level: LevelInfo, Service: "bench", Message: "throughput benchmark"}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := logger.Write(entry); err != nil {
+					b.Fatal(err)
+				}
+				if bench.reopen {
+					// Flush and close without the fsync of Close, as the old per-entry open/close did
+					fs := sink.(*fileSink)
+					if err := fs.Flush(); err != nil {
+						b.Fatal(err)
+					}
+					fs.discard()
+				}
+			}
+			if err := logger.Close(); err != nil {
+				b.Fatal(err)
+			}
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "entries/s")
+		})
+	}
+}
+
+// benchFileSink returns a fileSink in a temporary directory that never rotates
+func benchFileSink(b *testing.B) Sink {
+	return newFileSink(fileConfig{path: filepath.Join(b.TempDir(), "app.log"), maxSize: 1 << 40, maxFiles: 1, naming: namingNumbered})
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package main
+
+// defaultLogFile is where logs are written unless -log-file or LOG_FILE says otherwise
+func defaultLogFile() string {
+	return "/var/log/app.log"
+}
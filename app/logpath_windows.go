@@ -0,0 +1,12 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// defaultLogFile is where logs are written unless -log-file or LOG_FILE says otherwise
+// Windows has no /var/log, so the default is under the user's temporary directory (%TEMP%)
+func defaultLogFile() string {
+	return filepath.Join(os.TempDir(), "app.log")
+}
@@ -1,154 +1,946 @@
-package main
-
-import (
-	"encoding/json"
-	"fmt"
-	"log"
-	"math/rand"
-	"os"
-	"time"
-)
-
-// LogEntry represents a structured log entry with various fields for monitoring
-type LogEntry struct {
-	Timestamp    string  `json:"timestamp"`
-	Level        string  `json:"level"`
-	Service      string  `json:"service"`
-	Message      string  `json:"message"`
-	UserID       string  `json:"user_id,omitempty"`
-	Endpoint     string  `json:"endpoint,omitempty"`
-	ResponseTime int     `json:"response_time_ms,omitempty"`
-	StatusCode   int     `json:"status_code,omitempty"`
-	Region       string  `json:"region,omitempty"`
-	Component    string  `json:"component,omitempty"`
-}
-
-// Configuration variables for log generation and rotation
-var (
-	// Sample data for generating realistic logs
-	users     = []string{"user_001", "user_002", "user_003", "user_004", "user_005"}
-	endpoints = []string{"/api/login", "/api/users", "/api/orders", "/api/products", "/api/payments"}
-	regions   = []string{"us-east-1", "us-west-2", "eu-west-1", "ap-south-1"}
-	components = []string{"auth-service", "user-service", "order-service", "payment-service", "notification-service"}
-	services  = []string{"web-server", "api-gateway", "database", "cache", "queue"}
-	
-	// Log rotation configuration
-	logFile   = "/var/log/app.log"           // Main log file path
-	maxSize   = int64(10 * 1024 * 1024)      // 10MB - rotate when file exceeds this size
-	maxFiles  = 5                            // Keep 5 historical log files (app.log.1 to app.log.5)
-)
-
-// rotateLog handles log file rotation when the current log file exceeds maxSize
-// It shifts existing rotated files (app.log.1 -> app.log.2, etc.) and moves current log to app.log.1
-func rotateLog() {
-	// Check if current log file exists and exceeds size limit
-	info, err := os.Stat(logFile)
-	if err != nil || info.Size() < maxSize {
-		return // No rotation needed
-	}
-
-	// Shift existing rotated files: app.log.4 -> app.log.5, app.log.3 -> app.log.4, etc.
-	for i := maxFiles - 1; i > 0; i-- {
-		old := fmt.Sprintf("%s.%d", logFile, i)
-		new := fmt.Sprintf("%s.%d", logFile, i+1)
-		os.Rename(old, new) // Oldest file (app.log.5) gets overwritten
-	}
-
-	// Move current active log file to app.log.1
-	os.Rename(logFile, logFile+".1")
-}
-
-// writeLog writes a log entry to the file, handling rotation automatically
-func writeLog(entry LogEntry) {
-	// Check and perform log rotation if needed
-	rotateLog()
-
-	// Open log file for appending (create if doesn't exist)
-	file, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer file.Close()
-
-	// Set current timestamp and write JSON log entry
-	entry.Timestamp = time.Now().Format(time.RFC3339)
-	jsonLog, _ := json.Marshal(entry)
-	file.Write(append(jsonLog, '\n'))
-}
-
-// generateLogs creates realistic log entries with various types:
-// - API request logs with user activity, performance metrics
-// - Component health logs with error/warning/info levels
-// - Debug logs for system processing information
-func generateLogs() {
-	rand.Seed(time.Now().UnixNano())
-	
-	// Generate API request log with realistic user interaction data
-	user := users[rand.Intn(len(users))]
-	endpoint := endpoints[rand.Intn(len(endpoints))]
-	responseTime := rand.Intn(500) + 50  // 50-550ms response time
-	statusCode := []int{200, 201, 400, 401, 404, 500}[rand.Intn(6)]  // Mix of success/error codes
-	
-	writeLog(LogEntry{
-		Level:        "INFO",
-		Service:      "api-gateway",
-		Message:      "API request processed",
-		UserID:       user,
-		Endpoint:     endpoint,
-		ResponseTime: responseTime,
-		StatusCode:   statusCode,
-		Region:       regions[rand.Intn(len(regions))],
-	})
-
-	// Generate component health logs with realistic error rates
-	component := components[rand.Intn(len(components))]
-	service := services[rand.Intn(len(services))]
-	
-	if rand.Float32() < 0.1 { // 10% error rate - realistic for production systems
-		writeLog(LogEntry{
-			Level:     "ERROR",
-			Service:   service,
-			Message:   fmt.Sprintf("%s encountered an error", component),
-			Component: component,
-			Region:    regions[rand.Intn(len(regions))],
-		})
-	} else if rand.Float32() < 0.2 { // 20% warning rate - performance degradation
-		writeLog(LogEntry{
-			Level:     "WARN",
-			Service:   service,
-			Message:   fmt.Sprintf("%s performance degraded", component),
-			Component: component,
-			Region:    regions[rand.Intn(len(regions))],
-		})
-	} else { // 70% normal operation
-		writeLog(LogEntry{
-			Level:     "INFO",
-			Service:   service,
-			Message:   fmt.Sprintf("%s operating normally", component),
-			Component: component,
-			Region:    regions[rand.Intn(len(regions))],
-		})
-	}
-
-	// Generate debug logs occasionally (30% chance) for system processing info
-	if rand.Float32() < 0.3 {
-		writeLog(LogEntry{
-			Level:   "DEBUG",
-			Service: "debug-service",
-			Message: fmt.Sprintf("Processing batch of %d items", rand.Intn(100)+1),
-			Region:  regions[rand.Intn(len(regions))],
-		})
-	}
-}
-
-// main function starts the enhanced logging service with automatic log rotation
-func main() {
-	log.Println("Starting enhanced Go logging service with log rotation...")
-	log.Printf("Log rotation: %dMB max size, %d files retained", maxSize/(1024*1024), maxFiles)
-
-	// Continuous log generation with random intervals for realistic traffic patterns
-	for {
-		generateLogs()
-		time.Sleep(time.Duration(rand.Intn(3)+1) * time.Second) // 1-3 second intervals
-	}
-}
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// LogEntry represents a structured log entry with various fields for monitoring
+type LogEntry struct {
+	Timestamp         interface{}       `json:"timestamp"` // string for RFC 3339 formats, int64 for epoch formats
+	Seq               int64             `json:"seq"`       // Counts every entry written from 1, for spotting entries lost downstream
+	Level             Level             `json:"level"`
+	SeverityNumber    int               `json:"severity_number"` // OpenTelemetry severity number matching Level
+	Service           string            `json:"service"`
+	Message           string            `json:"message"`
+	UserID            string            `json:"user_id,omitempty"`
+	Endpoint          string            `json:"endpoint,omitempty"`
+	ResponseTime      int               `json:"response_time_ms,omitempty"`
+	StatusCode        int               `json:"status_code,omitempty"`
+	DownstreamService string            `json:"downstream_service,omitempty"`    // Service this request called, for service maps
+	DownstreamLatency int               `json:"downstream_latency_ms,omitempty"` // Time spent in that call, part of ResponseTime
+	Region            string            `json:"region,omitempty"`
+	Component         string            `json:"component,omitempty"`
+	TraceID           string            `json:"trace_id,omitempty"`
+	SpanID            string            `json:"span_id,omitempty"`
+	ErrorCode         string            `json:"error_code,omitempty"`
+	ErrorType         string            `json:"error_type,omitempty"`
+	StackTrace        string            `json:"stack_trace,omitempty"`
+	File              string            `json:"file,omitempty"` // Source location with -include-caller
+	Line              int               `json:"line,omitempty"`
+	Hostname          string            `json:"hostname"`
+	PodName           string            `json:"pod_name,omitempty"`
+	Env               string            `json:"env"` // Deployment stage from -env, e.g. dev, staging or prod
+	Version           string            `json:"service_version,omitempty"`
+	Attributes        map[string]string `json:"attributes,omitempty"`   // Custom labels such as tenant_id, as real services attach
+	Sampled           bool              `json:"sampled,omitempty"`      // Set when the entry's level is sampled and this one was kept
+	RepeatCount       int               `json:"repeat_count,omitempty"` // Identical entries this one stands for, with -dedup-window
+	Sequence          int64             `json:"sequence,omitempty"`     // Position in the heartbeat sequence, with -heartbeat-interval
+	Truncated         bool              `json:"truncated,omitempty"`    // Message or stack trace was shortened to fit -max-line-bytes
+}
+
+// errorDetail is a plausible failure attached to ERROR entries
+type errorDetail struct {
+	code  string // Error code as reported by the failing library or OS
+	kind  string // Error class, used by middleware.io for grouping
+	frame string // Innermost stack frame where the error surfaced
+}
+
+// Configuration variables for log generation and rotation
+var (
+	// Sample data for generating realistic logs
+	users     = []string{"user_001", "user_002", "user_003", "user_004", "user_005"}
+	endpoints = []string{"/api/login", "/api/users", "/api/orders", "/api/products", "/api/payments"}
+	regions   = []string{"us-east-1", "us-west-2", "eu-west-1", "ap-south-1"}
+
+	// Backend each api-gateway endpoint calls, so request logs form a consistent service graph
+	// and the component logs of the same trace come from that backend. Endpoints without an
+	// entry (e.g. from -seed-data without "backends") call a random component, and their
+	// component logs pair a random component with a random service
+	endpointBackends = map[string]string{
+		"/api/login":    "auth-service",
+		"/api/users":    "user-service",
+		"/api/orders":   "order-service",
+		"/api/products": "order-service",
+		"/api/payments": "payment-service",
+	}
+	components = []string{"auth-service", "user-service", "order-service", "payment-service", "notification-service"}
+	services   = []string{"web-server", "api-gateway", "database", "cache", "queue"}
+	errorKinds = []errorDetail{
+		{"ECONNREFUSED", "ConnectionError", "net.(*Dialer).DialContext\n\tnet/dial.go:580"},
+		{"ETIMEDOUT", "TimeoutError", "net/http.(*Client).do\n\tnet/http/client.go:724"},
+		{"DEADLOCK_DETECTED", "DatabaseError", "database/sql.(*DB).ExecContext\n\tdatabase/sql/sql.go:1685"},
+		{"POOL_EXHAUSTED", "DatabaseError", "database/sql.(*DB).conn\n\tdatabase/sql/sql.go:1324"},
+		{"CACHE_MISS_STORM", "CacheError", "github.com/redis/go-redis/v9.(*baseClient).process\n\tredis.go:386"},
+		{"UNAUTHENTICATED", "AuthError", "main.(*AuthService).Verify\n\tauth/verify.go:57"},
+	}
+
+	// Custom attribute keys and their possible values; each request trace carries a couple of them
+	// A slice rather than a map keeps the picks reproducible under -seed
+	attributePool = []struct {
+		key    string
+		values []string
+	}{
+		{"tenant_id", []string{"tenant-acme", "tenant-globex", "tenant-initech", "tenant-umbrella"}},
+		{"feature_flag", []string{"new-checkout", "dark-mode", "search-v2"}},
+		{"deployment", []string{"blue", "green", "canary"}},
+		{"plan", []string{"free", "pro", "enterprise"}},
+	}
+
+	// Log rotation configuration, handed to the file sink at startup
+	logFile     = defaultLogFile()        // Main log file path (/var/log/app.log, or %TEMP%\app.log on Windows)
+	maxSize     = int64(10 * 1024 * 1024) // 10MB - rotate when file exceeds this size
+	maxFiles    = 5                       // Keep 5 historical log files (app.log.1 to app.log.5)
+	logFileMode = fileMode(0644)          // Permissions for newly created log files, rotated ones included
+	logDirMode  = fileMode(0755)          // Permissions for the log directory when it has to be created
+
+	compressRotated  = false                       // Gzip rotated files to app.log.1.gz, app.log.2.gz, etc.
+	rotateInterval   = time.Duration(0)            // Also rotate once the active file is older than this (0 disables)
+	strictSize       = false                       // Rotate before a write that would take the file past maxSize, not after
+	splitByService   = false                       // Write each service's entries to its own <service>.log next to logFile instead
+	recordMeta       = false                       // Write an app.log.N.meta sidecar with the line count and SHA-256 of each rotated file
+	rotateNaming     = namingNumbered              // How rotated files are named: numbered (app.log.1) or dated (app-2024-06-01.log)
+	maxAge           = time.Duration(0)            // With dated naming, also remove rotated files older than this (0 disables)
+	maxTotalSize     = byteSize(0)                 // Also remove the oldest rotated files once they take up more than this (0 disables)
+	rotateJitter     = time.Duration(0)            // Spread time-based rotation over ±this much between instances (0 disables)
+	fsyncMode        = fsyncPolicy{mode: fsyncOff} // When written entries are forced to disk with fsync
+	externalRotation = false                       // Leave rotation to logrotate or similar, reopening the log file on SIGHUP
+	truncateOnStart  = false                       // Empty the log file at startup instead of appending to it
+	cleanStart       = false                       // Also remove the rotated files at startup
+
+	// Generation pacing: by default each iteration is followed by a random 1-3 second pause
+	rate       = 0.0         // Target log entries per second (0 keeps the default cadence)
+	burstSize  = 0           // Emit this many entries back-to-back, then pause (0 disables burst mode)
+	burstPause = time.Second // Pause between bursts
+
+	latencyDist = latencyUniform // Response-time distribution for API request logs
+
+	region = regionRandom // Region every entry is tagged with, or regionRandom to pick one per entry
+
+	minLevel = LevelDebug // Entries below this level are generated but not written
+
+	includeCaller = false // Add file and line fields locating the code that emitted each entry
+
+	// Per-level sampling: only 1 in N entries of a sampled level is written (unset levels are always kept)
+	sampleRates = sampleRatios{}
+	sampleSeen  = map[Level]int{} // Entries seen so far per sampled level, guarded by sampleMu
+	sampleMu    sync.Mutex
+
+	// Level mix of component health logs: 10% errors (realistic for production systems),
+	// 20% warnings and 70% normal operation
+	levelWeights = weightedLevels{{LevelError, 10}, {LevelWarn, 20}, {LevelInfo, 70}}
+
+	// Share of component errors that are repeated 2-10 more times in a row, as a retry loop would
+	errorFloodChance = float32(0.1)
+
+	// Run limits: the generator stops after runDuration or maxEntries, whichever comes first (0 means unlimited)
+	runDuration  = time.Duration(0)
+	maxEntries   = int64(0)
+	totalEmitted atomic.Int64 // Entries emitted so far, counted as they are claimed by reserveEntry
+
+	// The generator exits once this many writes in a row have failed (0 never gives up)
+	maxWriteFailures = defaultMaxWriteFailures
+	writeFailures    atomic.Int64 // Current run of consecutive failed writes
+
+	// Instance identity, resolved once at startup and attached to every entry
+	hostname string // From os.Hostname()
+	podName  string // From POD_NAME, typically set via the Kubernetes downward API
+
+	// Deployment metadata attached to every entry so dashboards can filter on it
+	appEnv     = "dev" // Stage: dev, staging, prod, ...
+	appVersion = ""    // Version of the emitting service (empty omits service_version)
+
+	// seed fixes the random source so runs are reproducible; seedSet records whether -seed was given
+	seed    int64
+	seedSet bool
+
+	// once writes a single generated entry and exits, for CI smoke tests; without -seed it uses onceSeed
+	once = false
+)
+
+// onceSeed is the seed -once uses when -seed is not given, so the entry is the same on every run
+const onceSeed = 1
+
+// emit filters, renders and annotates one generated entry and hands it to the writer,
+// reporting whether it was written rather than filtered out or over -max-entries
+func emit(ctx context.Context, logger *Logger, entry LogEntry) bool {
+	if severityNumber(entry.Level) < severityNumber(minLevel) {
+		logsFiltered.inc(entry.Level) // Counted so the filter's effect shows up in metrics
+		return false
+	}
+	if n := sampleRates[entry.Level]; n > 1 {
+		// Keep the first of every n entries, so the ratio is exact rather than random
+		sampleMu.Lock()
+		sampleSeen[entry.Level]++
+		keep := sampleSeen[entry.Level]%n == 1
+		sampleMu.Unlock()
+		if !keep {
+			logsFiltered.inc(entry.Level)
+			return false
+		}
+		entry.Sampled = true
+	}
+	if !reserveEntry() {
+		return false // Limit reached mid-iteration; drop the rest so the cap is exact
+	}
+	entry.Message = renderMessage(entry)
+	annotate(&entry)
+	submit(ctx, logger, entry)
+	return true
+}
+
+// randomIteration creates one iteration of realistic log entries with various types:
+// - API request logs with user activity, performance metrics
+// - Component health logs with error/warning/info levels (10%/20%/70% by default, see levelWeights)
+// - Debug logs for system processing information (30% of iterations)
+// now decides whether an incident is under way
+func randomIteration(rng *rand.Rand, now time.Time) []LogEntry {
+	var entries []LogEntry
+	add := func(entry LogEntry) {
+		if includeCaller {
+			entry.File, entry.Line = callerLocation(entry.Service)
+		}
+		entries = append(entries, entry)
+	}
+
+	// Generate API request log with realistic user interaction data
+	user := users[rng.Intn(len(users))]
+	endpoint := endpoints[rng.Intn(len(endpoints))]
+	statusCode := []int{200, 201, 400, 401, 404, 500}[rng.Intn(6)] // Mix of success/error codes
+	incident := inIncident(now)
+	if incident && rng.Float64() < incidentErrorRatio {
+		statusCode = []int{500, 502, 503}[rng.Intn(3)] // A failing dependency surfaces as 5xx
+	}
+	level, message := requestOutcome(statusCode)
+	responseTime := generateResponseTime(rng)
+	if statusCode >= 500 {
+		// Server errors are usually timeouts or retries against a sick dependency, so they run slow
+		// Client errors are rejected early and keep the normal latency profile
+		responseTime = int(float64(responseTime) * (2 + 2*rng.Float64()))
+	}
+	downstream, ok := endpointBackends[endpoint]
+	if !ok {
+		downstream = components[rng.Intn(len(components))]
+	}
+	// Most of a request's time is spent in the backend call, the rest in the gateway itself
+	downstreamLatency := int(float64(responseTime) * (0.5 + 0.4*rng.Float64()))
+	traceID := randomHex(rng, 16) // W3C-style 16-byte trace id shared by this iteration's related logs
+	attributes := randomAttributes(rng)
+
+	add(LogEntry{
+		Level:        level,
+		Service:      "api-gateway",
+		Message:      message,
+		UserID:       user,
+		Endpoint:     endpoint,
+		ResponseTime: responseTime,
+		StatusCode:   statusCode,
+		Region:       pickRegion(rng),
+
+		DownstreamService: downstream,
+		DownstreamLatency: downstreamLatency,
+		TraceID:           traceID,
+		Attributes:        attributes,
+		SpanID:            randomHex(rng, 8),
+	})
+
+	// Generate component health logs, choosing the level from the configured weights
+	// They share the request's trace, so for an endpoint with a known backend they come from
+	// that backend: /api/payments failures are logged by payment-service, not by any service
+	component := components[rng.Intn(len(components))]
+	service := services[rng.Intn(len(services))]
+	if backend, ok := endpointBackends[endpoint]; ok {
+		component, service = backend, backend
+	}
+
+	weights := levelWeights
+	if incident {
+		weights = incidentWeights
+	}
+	switch pickLevel(rng, weights) {
+	case LevelError:
+		failure := componentFailure(rng, service, component, traceID, attributes) // Same trace as the request so the UI can correlate them
+		add(failure)
+		// Now and then a failing loop floods the log with the same error (see -dedup-window)
+		if rng.Float32() < errorFloodChance {
+			for i := 2 + rng.Intn(9); i > 0; i-- {
+				add(failure)
+			}
+		}
+	case LevelWarn: // Performance degradation
+		add(LogEntry{
+			Level:      LevelWarn,
+			Service:    service,
+			Message:    fmt.Sprintf("%s performance degraded", component),
+			Component:  component,
+			Region:     pickRegion(rng),
+			TraceID:    traceID, // Same trace as the request so the UI can correlate them
+			Attributes: attributes,
+			SpanID:     randomHex(rng, 8),
+		})
+	default: // Normal operation
+		add(LogEntry{
+			Level:     LevelInfo,
+			Service:   service,
+			Message:   fmt.Sprintf("%s operating normally", component),
+			Component: component,
+			Region:    pickRegion(rng),
+		})
+	}
+
+	// Generate debug logs occasionally (30% chance) for system processing info
+	if rng.Float32() < 0.3 {
+		add(LogEntry{
+			Level:   LevelDebug,
+			Service: "debug-service",
+			Message: fmt.Sprintf("Processing batch of %d items", rng.Intn(100)+1),
+			Region:  pickRegion(rng),
+		})
+	}
+	return entries
+}
+
+// componentFailure returns an ERROR entry for component of service failing with a random
+// error kind and its stack trace, in trace traceID
+func componentFailure(rng *rand.Rand, service, component, traceID string, attributes map[string]string) LogEntry {
+	detail := errorKinds[rng.Intn(len(errorKinds))]
+	return LogEntry{
+		Level:      LevelError,
+		Service:    service,
+		Message:    fmt.Sprintf("%s encountered an error", component),
+		Component:  component,
+		Region:     pickRegion(rng),
+		TraceID:    traceID,
+		Attributes: attributes,
+		SpanID:     randomHex(rng, 8),
+		ErrorCode:  detail.code,
+		ErrorType:  detail.kind,
+		StackTrace: stackTrace(rng, detail, component),
+	}
+}
+
+// reopenOnHangup reopens the log file whenever the process receives SIGHUP, until ctx is done
+// This is how logrotate and similar tools tell a daemon they have moved its log aside
+func reopenOnHangup(ctx context.Context, logger *Logger) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if err := logger.Reopen(); err != nil {
+				log.Printf("warning: failed to flush log output on SIGHUP: %v", err)
+			} else {
+				log.Println("Received SIGHUP, reopened log output")
+			}
+		}
+	}
+}
+
+// regionRandom as -region picks a region from regions for every entry
+const regionRandom = "random"
+
+// pickRegion returns the region for an entry: the pinned -region, or a random one
+func pickRegion(rng *rand.Rand) string {
+	if region != regionRandom {
+		return region
+	}
+	return regions[rng.Intn(len(regions))]
+}
+
+// callerLocation returns the source location of the add call that produced an entry for service
+// The line is the real one from runtime.Caller, so each kind of entry keeps a stable location,
+// while the file is placed in a fake per-service source tree such as services/api-gateway/main.go
+func callerLocation(service string) (string, int) {
+	_, file, line, ok := runtime.Caller(2) // Skip callerLocation and add
+	if !ok {
+		return "", 0
+	}
+	return path.Join("services", service, filepath.Base(file)), line
+}
+
+// annotate fills in the fields every entry carries: its severity number and the identity
+// and deployment metadata of this instance
+func annotate(entry *LogEntry) {
+	entry.SeverityNumber = severityNumber(entry.Level)
+	entry.Hostname = hostname
+	entry.PodName = podName
+	entry.Env = appEnv
+	entry.Version = appVersion
+}
+
+// reserveEntry claims one of the maxEntries slots, reporting false once they are all taken
+// Claiming before writing keeps the cap exact with several workers
+func reserveEntry() bool {
+	for {
+		n := totalEmitted.Load()
+		if maxEntries > 0 && n >= maxEntries {
+			return false
+		}
+		if totalEmitted.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// entryLimitReached reports whether maxEntries entries have been emitted
+func entryLimitReached() bool {
+	return maxEntries > 0 && totalEmitted.Load() >= maxEntries
+}
+
+// writeEntry writes entry through logger; the caller must have reserved it with reserveEntry
+// Transient I/O problems (permission blips, flaky mounts) are logged and ridden out, and the
+// process only gives up once failures persist across maxWriteFailures entries in a row
+func writeEntry(ctx context.Context, logger *Logger, entry LogEntry) {
+	err := logger.Write(entry)
+	if waitingFor(err) != "" && ctx.Err() == nil {
+		err = retryBlocked(ctx, logger, entry, err)
+	}
+	if err != nil {
+		failures := writeFailures.Add(1)
+		log.Printf("warning: %v", err)
+		if maxWriteFailures > 0 && failures >= int64(maxWriteFailures) {
+			logger.Close() // Keep whatever the output still accepts; log.Fatalf skips deferred calls
+			log.Fatalf("giving up after %d consecutive write failures", failures)
+		}
+	} else {
+		writeFailures.Store(0)
+	}
+}
+
+// Blocked-output retries start at blockedMinBackoff and double up to blockedMaxBackoff
+const (
+	blockedMinBackoff = time.Second
+	blockedMaxBackoff = 30 * time.Second
+)
+
+// waitingFor describes what a write that failed with err has to wait for before it can
+// succeed, or returns "" if err is not one that waiting fixes
+func waitingFor(err error) string {
+	switch {
+	case errors.Is(err, syscall.ENOSPC):
+		return "space is available"
+	case errors.Is(err, syscall.EPIPE), errors.Is(err, syscall.ENXIO):
+		return "a reader opens the pipe" // -log-file is a FIFO with nobody reading it
+	}
+	return ""
+}
+
+// retryBlocked pauses generation while writes fail because the output is blocked (disk full,
+// no reader on a named pipe), retrying entry with exponential backoff until it is written,
+// another error occurs or ctx is done
+// Carrying on would only spin and drop every entry until the output recovers, so it waits
+// instead, and warns once per episode rather than on every attempt
+func retryBlocked(ctx context.Context, logger *Logger, entry LogEntry, err error) error {
+	log.Printf("warning: %v; pausing generation until %s", err, waitingFor(err))
+	backoff := blockedMinBackoff
+	for waitingFor(err) != "" {
+		if !logger.clock.Sleep(ctx, backoff) {
+			return err
+		}
+		backoff = min(backoff*2, blockedMaxBackoff)
+		// Flush straight away: a write that only reached the buffer says nothing about the output
+		if err = logger.Write(entry); err == nil {
+			err = logger.Flush()
+		}
+	}
+	if err == nil {
+		log.Println("Output writable again, resuming generation")
+	}
+	return err
+}
+
+// stackTrace returns the stack trace for an ERROR entry: usually just the innermost frame,
+// but occasionally (25%) a full multi-line Go or Java trace for exercising Fluent Bit's multiline
+// parser. The newlines are escaped by every output format, so each record stays on one physical line
+func stackTrace(rng *rand.Rand, detail errorDetail, component string) string {
+	if rng.Float32() >= 0.25 {
+		return detail.frame
+	}
+
+	pkg := strings.ReplaceAll(component, "-", "")
+	if rng.Intn(2) == 0 {
+		return fmt.Sprintf("goroutine %d [running]:\n"+
+			"%s\n"+
+			"main.(*%sHandler).ServeHTTP(0xc000%06x, {0x9a4e10, 0xc0001c2000}, 0xc0002b4100)\n"+
+			"\t/app/%s/handler.go:%d +0x1a4\n"+
+			"net/http.serverHandler.ServeHTTP({0xc000118000}, {0x9a4e10, 0xc0001c2000}, 0xc0002b4100)\n"+
+			"\t/usr/local/go/src/net/http/server.go:2938 +0x8e\n"+
+			"net/http.(*conn).serve(0xc00019a000, {0x9a5a38, 0xc000176f30})\n"+
+			"\t/usr/local/go/src/net/http/server.go:2009 +0x5f4\n"+
+			"created by net/http.(*Server).Serve in goroutine 1\n"+
+			"\t/usr/local/go/src/net/http/server.go:3086 +0x4db",
+			rng.Intn(500)+1, detail.frame, strings.ToUpper(pkg[:1])+pkg[1:], rng.Intn(0xffffff), component, rng.Intn(300)+20)
+	}
+	return fmt.Sprintf("com.example.%s.%s: %s\n"+
+		"\tat com.example.%s.Client.call(Client.java:%d)\n"+
+		"\tat com.example.%s.Service.handle(Service.java:%d)\n"+
+		"\tat org.springframework.web.servlet.FrameworkServlet.service(FrameworkServlet.java:897)\n"+
+		"\tat javax.servlet.http.HttpServlet.service(HttpServlet.java:750)\n"+
+		"Caused by: java.io.IOException: %s\n"+
+		"\tat java.base/sun.nio.ch.Net.connect0(Native Method)\n"+
+		"\t... 12 more",
+		pkg, detail.kind, detail.code, pkg, rng.Intn(200)+20, pkg, rng.Intn(200)+20, detail.code)
+}
+
+// levelWeight is the relative likelihood of a level being chosen by pickLevel
+type levelWeight struct {
+	level  Level
+	weight float64
+}
+
+// weightedLevels is an ordered level->weight table, settable from a flag such as
+// "ERROR=40,WARN=20,INFO=40". The order is kept so a given random sequence always
+// maps to the same levels
+type weightedLevels []levelWeight
+
+// String implements flag.Value
+func (w *weightedLevels) String() string {
+	parts := make([]string, len(*w))
+	for i, lw := range *w {
+		parts[i] = fmt.Sprintf("%s=%g", lw.level, lw.weight)
+	}
+	return strings.Join(parts, ",")
+}
+
+// Set implements flag.Value, accepting comma-separated LEVEL=weight pairs
+// Only ERROR, WARN and INFO can be weighted; weights are relative and need not sum to 100
+func (w *weightedLevels) Set(value string) error {
+	var parsed weightedLevels
+	total := 0.0
+	for _, pair := range strings.Split(value, ",") {
+		name, weightStr, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return fmt.Errorf("%q is not LEVEL=weight", pair)
+		}
+		level, err := parseLevel(name)
+		if err != nil {
+			return err
+		}
+		if level == LevelDebug {
+			return fmt.Errorf("unsupported level %s: must be %s", level, levelNames(levels[1:]))
+		}
+		weight, err := strconv.ParseFloat(weightStr, 64)
+		if err != nil || weight < 0 {
+			return fmt.Errorf("weight for %s must be a non-negative number, got %q", level, weightStr)
+		}
+		parsed = append(parsed, levelWeight{level, weight})
+		total += weight
+	}
+	if total <= 0 {
+		return fmt.Errorf("at least one weight must be greater than zero")
+	}
+	*w = parsed
+	return nil
+}
+
+// sampleRatios maps a level to N, keeping 1 in N of its entries; it is settable from a
+// flag such as "INFO=10,DEBUG=100"
+type sampleRatios map[Level]int
+
+// String implements flag.Value
+func (s *sampleRatios) String() string {
+	parts := make([]string, 0, len(*s))
+	for level, n := range *s {
+		parts = append(parts, fmt.Sprintf("%s=%d", level, n))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+// Set implements flag.Value, accepting comma-separated LEVEL=N pairs
+func (s *sampleRatios) Set(value string) error {
+	parsed := sampleRatios{}
+	for _, pair := range strings.Split(value, ",") {
+		name, nStr, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return fmt.Errorf("%q is not LEVEL=N", pair)
+		}
+		level, err := parseLevel(name)
+		if err != nil {
+			return err
+		}
+		n, err := strconv.Atoi(nStr)
+		if err != nil || n < 1 {
+			return fmt.Errorf("ratio for %s must be a positive integer, got %q", level, nStr)
+		}
+		parsed[level] = n
+	}
+	*s = parsed
+	return nil
+}
+
+// pickLevel chooses a level with probability proportional to its weight
+// A single random draw is compared against cumulative weights, so the configured
+// proportions hold exactly rather than compounding across independent draws
+func pickLevel(rng *rand.Rand, weights weightedLevels) Level {
+	total := 0.0
+	for _, lw := range weights {
+		total += lw.weight
+	}
+	r := rng.Float64() * total
+	for _, lw := range weights {
+		if r < lw.weight {
+			return lw.level
+		}
+		r -= lw.weight
+	}
+	return weights[len(weights)-1].level // Guard against floating-point rounding
+}
+
+// requestOutcome derives the log level and message of an API request log from its status code
+// so that, like a real service, 5xx responses are errors and 4xx responses are warnings
+func requestOutcome(statusCode int) (level Level, message string) {
+	switch {
+	case statusCode >= 500:
+		return LevelError, "API request failed"
+	case statusCode >= 400:
+		return LevelWarn, "API request rejected"
+	default:
+		return LevelInfo, "API request processed"
+	}
+}
+
+// Response-time distributions selectable with -latency-dist
+const (
+	latencyUniform   = "uniform"   // Flat 50-550ms
+	latencyLognormal = "lognormal" // Most requests near ~120ms with a long right tail
+	latencyBimodal   = "bimodal"   // Fast cache hits plus a slow cluster of cache misses
+)
+
+// generateResponseTime draws a response time in milliseconds from latencyDist
+func generateResponseTime(rng *rand.Rand) int {
+	var ms float64
+	switch latencyDist {
+	case latencyLognormal:
+		ms = math.Exp(math.Log(120) + 0.6*rng.NormFloat64())
+	case latencyBimodal:
+		if rng.Float64() < 0.9 {
+			ms = 80 + 20*rng.NormFloat64() // Fast path
+		} else {
+			ms = 900 + 250*rng.NormFloat64() // Slow path
+		}
+	default:
+		ms = float64(rng.Intn(500) + 50) // 50-550ms response time
+	}
+	if ms < 1 {
+		ms = 1 // Normal tails can dip below zero; no request is instantaneous
+	}
+	return int(ms)
+}
+
+// randomAttributes picks two distinct attributes from attributePool with random values
+func randomAttributes(rng *rand.Rand) map[string]string {
+	attrs := make(map[string]string, 2)
+	for _, i := range rng.Perm(len(attributePool))[:2] {
+		a := attributePool[i]
+		attrs[a.key] = a.values[rng.Intn(len(a.values))]
+	}
+	return attrs
+}
+
+// randomHex returns n random bytes from rng encoded as a lowercase hex string
+func randomHex(rng *rand.Rand, n int) string {
+	b := make([]byte, n)
+	rng.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// openSink creates the Sink for one -output destination, logging where entries will go
+func openSink(output string, clock Clock) Sink {
+	switch output {
+	case outputHTTP:
+		log.Printf("Sending logs to %s in batches of %d", httpEndpoint, httpBatchSize)
+		return startHTTPSink()
+	case outputOTLP:
+		log.Printf("Exporting logs over OTLP/HTTP to %s in batches of %d", otlpEndpoint, httpBatchSize)
+		return startOTLPSink()
+	case outputStdout:
+		// Container-native collection: no file, so nothing to rotate
+		if compressStdout {
+			log.Println("Writing gzip-compressed logs to stdout")
+			return newGzipSink(os.Stdout)
+		}
+		log.Println("Writing logs to stdout")
+		return newWriterSink(os.Stdout)
+	}
+
+	cfg := fileConfig{
+		path:     logFile,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+		compress: compressRotated,
+		interval: rotateInterval,
+		strict:   strictSize,
+		meta:     recordMeta,
+		naming:   rotateNaming,
+		maxAge:   maxAge,
+		maxTotal: int64(maxTotalSize),
+		clock:    clock,
+		mode:     os.FileMode(logFileMode),
+		jitter:   rotationJitter(rotateJitter),
+		fsync:    fsyncMode,
+		external: externalRotation,
+		truncate: truncateOnStart || cleanStart,
+		clean:    cleanStart,
+	}
+	if info, err := os.Stat(logFile); err == nil && info.Mode()&os.ModeNamedPipe != 0 && !splitByService {
+		log.Printf("Writing logs to named pipe %s; rotation is disabled", logFile)
+		return newFileSink(cfg)
+	}
+	var sink Sink
+	if splitByService {
+		log.Printf("Writing logs to one <service>.log file per service in %s", filepath.Dir(logFile))
+		sink = newRoutedSink(cfg, servicePath)
+	} else {
+		log.Printf("Writing logs to %s", logFile)
+		sink = newFileSink(cfg)
+	}
+	if externalRotation {
+		log.Println("Log rotation: left to an external tool; send SIGHUP after moving the file")
+	} else {
+		// In the largest unit that fits evenly, since LOG_MAX_SIZE_BYTES allows any byte count
+		size := byteSize(maxSize)
+		limit := size.String()
+		if limit == strconv.FormatInt(maxSize, 10) {
+			limit += " bytes"
+		}
+		log.Printf("Log rotation: %s max size, %d %s files retained", limit, maxFiles, rotateNaming)
+	}
+	if cfg.jitter != 0 && !externalRotation {
+		log.Printf("Time-based rotation offset by %s on this instance (-rotate-jitter %s)", cfg.jitter.Round(time.Millisecond), rotateJitter)
+	}
+	return sink
+}
+
+// main function starts the enhanced logging service with automatic log rotation
+func main() {
+	// "app tail [flags]" follows the log instead of generating it; the flags still apply
+	tailMode := len(os.Args) > 1 && os.Args[1] == "tail"
+	if tailMode {
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+
+	loadConfig()
+	parseFlags()
+	if tailMode {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := tailLog(ctx, os.Stdout, logFile, useColor(os.Stdout)); err != nil {
+			log.Fatalf("tail %s: %v", logFile, err)
+		}
+		return
+	}
+	if verifyOnly {
+		if !verifyRotated(os.Stdout, logFile, maxFiles) {
+			os.Exit(1)
+		}
+		return
+	}
+	if printParserOnly {
+		printParser(os.Stdout)
+		return
+	}
+	if schemaFile != "" {
+		schema, err := loadSchema(schemaFile)
+		if err != nil {
+			log.Fatalf("invalid -schema: %v", err)
+		}
+		entrySchema = schema
+	}
+	if seedDataFile != "" {
+		if err := loadSeedData(seedDataFile); err != nil {
+			log.Fatalf("invalid -seed-data: %v", err)
+		}
+	}
+
+	var err error
+	if hostname, err = os.Hostname(); err != nil {
+		log.Printf("warning: could not determine hostname: %v", err)
+	}
+	podName = os.Getenv("POD_NAME")
+
+	log.Println("Starting enhanced Go logging service with log rotation...")
+	logEffectiveConfig()
+	var clock Clock = realClock{}
+	var sink Sink
+	if dryRun {
+		log.Println("Dry run: printing log entries to stderr, nothing will be written or rotated")
+		stderr := newWriterSink(os.Stderr)
+		stderr.flushEvery = 0 // Show each entry as soon as it is generated
+		sink = stderr
+	} else {
+		var names []string
+		var sinks []Sink
+		for _, output := range outputs() {
+			names = append(names, output)
+			sinks = append(sinks, openSink(output, clock))
+		}
+		sink = sinks[0]
+		if len(sinks) > 1 {
+			log.Printf("Writing every entry to %s; an output that falls behind drops entries without holding up the others", strings.Join(names, ", "))
+			sink = newMultiSink(names, sinks)
+		}
+	}
+	if fallbackStdout && !dryRun {
+		threshold := maxWriteFailures
+		if threshold == 0 {
+			threshold = defaultMaxWriteFailures // Never giving up still needs a point at which to switch
+		}
+		sink = newFallbackSink(sink, threshold)
+	}
+	if dedupWindow > 0 {
+		log.Printf("Collapsing identical consecutive entries within %s into one with repeat_count", dedupWindow)
+		sink = newDedupSink(sink, dedupWindow, clock)
+	}
+	logger := NewLogger(sink, clock)
+	defer logger.Close() // Backstop for a panic in main; the normal shutdown below closes it first
+
+	// Fail fast on an unwritable or misconfigured log volume; a pipe has no directory of its own to probe
+	if hasOutput(outputFile) && !dryRun {
+		if err := ensureLogDir(filepath.Dir(logFile), os.FileMode(logDirMode)); err != nil {
+			log.Fatal(err)
+		}
+		if info, err := os.Stat(logFile); err != nil || info.Mode()&os.ModeNamedPipe == 0 {
+			if err := selfTest(); err != nil {
+				log.Fatalf("self-test failed: %v", err)
+			}
+		}
+	}
+
+	// The metrics and health endpoints share one server when given the same address
+	muxes := map[string]*http.ServeMux{}
+	muxFor := func(addr string) *http.ServeMux {
+		if muxes[addr] == nil {
+			muxes[addr] = http.NewServeMux()
+		}
+		return muxes[addr]
+	}
+	if metricsAddr != "" {
+		log.Printf("Serving Prometheus metrics on %s/metrics and JSON stats on %s/stats", metricsAddr, metricsAddr)
+		muxFor(metricsAddr).HandleFunc("/metrics", handleMetrics)
+		muxFor(metricsAddr).HandleFunc("/stats", handleStats)
+	}
+	if healthAddr != "" {
+		log.Printf("Serving health checks on %s/healthz and %s/readyz", healthAddr, healthAddr)
+		registerHealth(muxFor(healthAddr), logger)
+	}
+	for addr, mux := range muxes {
+		serveHTTP(addr, mux)
+	}
+
+	// Stop cleanly on SIGINT/SIGTERM. Once the signal is caught it no longer kills the
+	// process outright, so an in-progress write always completes its line before we exit
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Optional run limits for CI and fixture generation; the default runs forever
+	if runDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, runDuration)
+		defer cancel()
+	}
+
+	go watchIncidents(ctx, clock)
+	go reopenOnHangup(ctx, logger)
+
+	// Random sources are seeded once at startup, in run, rather than per iteration, which
+	// would repeat sequences within the same clock tick. The seed is logged so any run can be reproduced
+	if !seedSet {
+		seed = time.Now().UnixNano()
+		if once {
+			seed = onceSeed
+		}
+	}
+	log.Printf("Random seed %d (pass -seed=%d to reproduce this sequence)", seed, seed)
+	if chaosRate > 0 {
+		chaosRNG = rand.New(rand.NewSource(seed))
+		log.Printf("warning: corrupting %g%% of records on purpose (-chaos-rate); for parser testing only", chaosRate*100)
+	}
+
+	if queueSize > 0 {
+		log.Printf("Queueing up to %d entries between generation and writing (%s when full)", queueSize, queuePolicy)
+		logQueue = startQueue(ctx, logger, queueSize, queuePolicy)
+	}
+
+	// The self-monitor, error floor and periodic flush stop together with generation, before the queue
+	// and output are closed
+	monitorCtx, stopMonitor := context.WithCancel(ctx)
+	var monitor sync.WaitGroup
+	monitor.Add(1)
+	go func() {
+		defer monitor.Done()
+		flushPeriodically(monitorCtx, logger, flushInterval)
+	}()
+	if minErrorsPerMinute > 0 {
+		log.Printf("Writing at least %d ERROR entries per minute", minErrorsPerMinute)
+		rng := rand.New(rand.NewSource(seed + int64(workers))) // Generator workers use seed to seed+workers-1
+		monitor.Add(1)
+		go func() {
+			defer monitor.Done()
+			errorFloor(monitorCtx, logger, rng, minErrorsPerMinute)
+		}()
+	}
+	if heartbeatInterval > 0 {
+		log.Printf("Writing a heartbeat entry every %s", heartbeatInterval)
+		monitor.Add(1)
+		go func() {
+			defer monitor.Done()
+			heartbeat(monitorCtx, logger, heartbeatInterval)
+		}()
+	}
+	if selfMetricsInterval > 0 {
+		monitor.Add(1)
+		go func() {
+			defer monitor.Done()
+			selfMonitor(monitorCtx, logger, selfMetricsInterval)
+		}()
+	}
+
+	if replayFile != "" {
+		log.Printf("Replaying %s at %gx speed", replayFile, replaySpeed)
+		if err := replay(ctx, logger, replayFile); err != nil {
+			log.Printf("warning: replay stopped: %v", err)
+		}
+	} else if once {
+		writeIteration(ctx, logger, newGenerator(rand.New(rand.NewSource(seed)), logger.clock))
+	} else {
+		// Continuous log generation, paced by run's pacer (random intervals for realistic traffic patterns by default)
+		if workers > 1 {
+			log.Printf("Generating on %d workers", workers)
+		}
+		run(ctx, logger, workers)
+	}
+	log.Println("Shutting down logging service")
+	stopMonitor()
+	monitor.Wait()
+	if logQueue != nil {
+		logQueue.close() // Write out whatever is still queued
+	}
+	if err := logger.Close(); err != nil {
+		log.Printf("warning: failed to flush and close log output: %v", err)
+	}
+	if countByLevel {
+		log.Print(runSummary()) // After Close, so the final writes and any last rotation are counted
+	}
+}
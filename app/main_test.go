@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestPickLevelFrequencies checks that pickLevel draws each level in proportion to its weight
+func TestPickLevelFrequencies(t *testing.T) {
+	const samples = 100_000
+	const tolerance = 0.01 // Several standard deviations at this sample size, so a fixed seed never flakes
+
+	tests := []struct {
+		name    string
+		weights weightedLevels
+	}{
+		{"default", levelWeights},
+		{"incident", incidentWeights},
+		{"unnormalized with a zero weight", weightedLevels{{LevelDebug, 0}, {LevelInfo, 3}, {LevelError, 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rng := rand.New(rand.NewSource(1))
+			counts := map[Level]int{}
+			for i := 0; i < samples; i++ {
+				counts[pickLevel(rng, tt.weights)]++
+			}
+
+			total := 0.0
+			for _, lw := range tt.weights {
+				total += lw.weight
+			}
+			for _, lw := range tt.weights {
+				got, want := float64(counts[lw.level])/samples, lw.weight/total
+				if math.Abs(got-want) > tolerance {
+					t.Errorf("%s drawn %.4f of the time, want %.4f±%.2f", lw.level, got, want, tolerance)
+				}
+				delete(counts, lw.level)
+			}
+			if len(counts) > 0 {
+				t.Errorf("drew levels without a weight: %v", counts)
+			}
+		})
+	}
+}
+
+// blockedSink is a Sink whose writes fail with err until failures of them have, then succeed
+type blockedSink struct {
+	err      error
+	failures int
+	attempts int
+	written  []LogEntry
+}
+
+func (s *blockedSink) Write(entry LogEntry) error {
+	s.attempts++
+	if s.failures > 0 {
+		s.failures--
+		return s.err
+	}
+	s.written = append(s.written, entry)
+	return nil
+}
+
+func (s *blockedSink) Flush() error { return nil }
+func (s *blockedSink) Close() error { return nil }
+
+// cancellingClock is a fakeClock that cancels a context on the given sleep, as a shutdown
+// signal arriving during that wait would
+type cancellingClock struct {
+	fakeClock
+	cancelOn int // Which sleep cancels, counting from 1
+	cancel   context.CancelFunc
+	sleeps   int
+}
+
+func (c *cancellingClock) Sleep(ctx context.Context, d time.Duration) bool {
+	if c.sleeps++; c.sleeps == c.cancelOn {
+		c.cancel()
+	}
+	return c.fakeClock.Sleep(ctx, d)
+}
+
+// TestWriteEntryRidesOutBlockedOutput checks that an entry whose write fails because the
+// disk is full, or a pipe has no reader, is retried with a doubling backoff until it gets
+// through, rather than dropped or counted towards -max-write-failures
+func TestWriteEntryRidesOutBlockedOutput(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"disk full", &os.PathError{Op: "write", Path: "/logs/app.log", Err: syscall.ENOSPC}},
+		{"no reader", &os.PathError{Op: "write", Path: "/logs/app.log", Err: syscall.EPIPE}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeFailures.Store(0)
+			start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+			clock := &fakeClock{now: start}
+			sink := &blockedSink{err: tt.err, failures: 3}
+			writeEntry(context.Background(), NewLogger(sink, clock), LogEntry{Level: LevelInfo, Service: "test", Message: "blocked"})
+
+			if len(sink.written) != 1 || sink.written[0].Message != "blocked" || sink.attempts != 4 {
+				t.Errorf("wrote %d entries in %d attempts, want the entry once in 4", len(sink.written), sink.attempts)
+			}
+			if got := writeFailures.Load(); got != 0 {
+				t.Errorf("%d consecutive failures recorded, want 0", got)
+			}
+			if got, want := clock.Now().Sub(start), 7*time.Second; got != want { // 1s + 2s + 4s
+				t.Errorf("waited %s in all, want %s", got, want)
+			}
+		})
+	}
+}
+
+// TestRetryBlockedStopsWhenCancelled checks that shutting down ends the wait for a blocked
+// output, returning the write's error instead of retrying forever
+func TestRetryBlockedStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clock := &cancellingClock{fakeClock: fakeClock{now: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}, cancelOn: 3, cancel: cancel}
+	sink := &blockedSink{err: syscall.ENOSPC, failures: 1 << 30}
+	logger := NewLogger(sink, clock)
+
+	entry := LogEntry{Level: LevelInfo, Service: "test", Message: "blocked"}
+	err := retryBlocked(ctx, logger, entry, logger.Write(entry))
+	if err != syscall.ENOSPC {
+		t.Errorf("retryBlocked = %v, want %v", err, syscall.ENOSPC)
+	}
+	// The first write, then one retry after each of the two sleeps before the cancelled one
+	if sink.attempts != 3 || len(sink.written) != 0 {
+		t.Errorf("%d attempts, %d written; want 3, 0", sink.attempts, len(sink.written))
+	}
+}
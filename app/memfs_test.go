@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock for tests: it only moves when told to, or when something sleeps on it
+type fakeClock struct {
+	now time.Time
+}
+
+// Now implements Clock
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+// Sleep implements Clock, advancing the clock by d straight away
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) bool {
+	c.now = c.now.Add(d)
+	return ctx.Err() == nil
+}
+
+// advance moves the clock forward by d
+func (c *fakeClock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// memFS is a fileSystem for tests that keeps every file in memory, as name -> *bytes.Buffer
+// An open file is tied to its buffer rather than its name, so as on disk a handle keeps writing
+// to a file after it is renamed or removed, and a fileSink only notices by comparing the two
+type memFS struct {
+	clock     Clock // Stamps modification times
+	files     map[string]*bytes.Buffer
+	modified  map[*bytes.Buffer]time.Time
+	renames   []string // Every successful rename, as "old -> new"
+	stats     int      // Stat calls, on a path or an open file
+	noReplace bool     // Renaming onto an existing file fails, as on Windows
+}
+
+// newMemFS returns an empty memFS telling the time by clock
+func newMemFS(clock Clock) *memFS {
+	return &memFS{clock: clock, files: map[string]*bytes.Buffer{}, modified: map[*bytes.Buffer]time.Time{}}
+}
+
+// OpenFile implements fileSystem; only O_CREATE and O_TRUNC of flag matter, since every
+// write appends
+func (m *memFS) OpenFile(name string, flag int, perm os.FileMode) (openFile, error) {
+	buf, ok := m.files[name]
+	switch {
+	case !ok && flag&os.O_CREATE == 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	case !ok:
+		buf = &bytes.Buffer{}
+		m.files[name] = buf
+		m.modified[buf] = m.clock.Now()
+	case flag&os.O_TRUNC != 0:
+		buf.Reset()
+		m.modified[buf] = m.clock.Now()
+	}
+	return &memFile{fs: m, name: name, buf: buf}, nil
+}
+
+// Stat implements fileSystem
+func (m *memFS) Stat(name string) (os.FileInfo, error) {
+	m.stats++
+	buf, ok := m.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return memFileInfo{name: filepath.Base(name), buf: buf, modified: m.modified[buf]}, nil
+}
+
+// Rename implements fileSystem, replacing newpath unless noReplace is set
+func (m *memFS) Rename(oldpath, newpath string) error {
+	buf, ok := m.files[oldpath]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrNotExist}
+	}
+	if _, taken := m.files[newpath]; taken && m.noReplace {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrExist}
+	}
+	delete(m.files, oldpath)
+	m.files[newpath] = buf
+	m.renames = append(m.renames, filepath.Base(oldpath)+" -> "+filepath.Base(newpath))
+	return nil
+}
+
+// Remove implements fileSystem
+func (m *memFS) Remove(name string) error {
+	if _, ok := m.files[name]; !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+// SameFile implements fileSystem: two infos describe the same file if they share a buffer
+func (m *memFS) SameFile(a, b os.FileInfo) bool {
+	return a.Sys() != nil && a.Sys() == b.Sys()
+}
+
+// movedAway returns how many times the file at name has been renamed to something else,
+// which for the active log is how many times it has rotated
+func (m *memFS) movedAway(name string) int {
+	n := 0
+	for _, r := range m.renames {
+		if strings.HasPrefix(r, filepath.Base(name)+" -> ") {
+			n++
+		}
+	}
+	return n
+}
+
+// names returns the base names of every file, sorted
+func (m *memFS) names() []string {
+	var names []string
+	for name := range m.files {
+		names = append(names, filepath.Base(name))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// seqs returns the seq of every JSON entry in the file name, in order
+func (m *memFS) seqs(t *testing.T, name string) []int64 {
+	t.Helper()
+	buf, ok := m.files[name]
+	if !ok {
+		t.Fatalf("%s does not exist", filepath.Base(name))
+	}
+	var seqs []int64
+	scanner := bufio.NewScanner(bytes.NewReader(buf.Bytes()))
+	for scanner.Scan() {
+		var entry LogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("%s: %v in %q", filepath.Base(name), err, scanner.Text())
+		}
+		seqs = append(seqs, entry.Seq)
+	}
+	return seqs
+}
+
+// memFile is an open memFS file
+type memFile struct {
+	fs     *memFS
+	name   string // Name it was opened by; it may have been renamed since
+	buf    *bytes.Buffer
+	closed bool
+}
+
+// Write implements io.Writer, appending p
+func (f *memFile) Write(p []byte) (int, error) {
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	f.fs.modified[f.buf] = f.fs.clock.Now()
+	return f.buf.Write(p)
+}
+
+// Stat implements openFile
+func (f *memFile) Stat() (os.FileInfo, error) {
+	f.fs.stats++
+	return memFileInfo{name: filepath.Base(f.name), buf: f.buf, modified: f.fs.modified[f.buf]}, nil
+}
+
+// Chmod implements openFile; memFS does not track permissions
+func (f *memFile) Chmod(os.FileMode) error {
+	return nil
+}
+
+// Sync implements openFile; there is nothing to sync
+func (f *memFile) Sync() error {
+	return nil
+}
+
+// Close implements openFile
+func (f *memFile) Close() error {
+	if f.closed {
+		return os.ErrClosed
+	}
+	f.closed = true
+	return nil
+}
+
+// memFileInfo describes a memFS file
+type memFileInfo struct {
+	name     string
+	buf      *bytes.Buffer
+	modified time.Time
+}
+
+func (i memFileInfo) Name() string       { return i.name }
+func (i memFileInfo) Size() int64        { return int64(i.buf.Len()) }
+func (i memFileInfo) Mode() os.FileMode  { return 0644 }
+func (i memFileInfo) ModTime() time.Time { return i.modified }
+func (i memFileInfo) IsDir() bool        { return false }
+func (i memFileInfo) Sys() any           { return i.buf }
+
+// seqRange returns the seqs from first to last
+func seqRange(first, last int64) []int64 {
+	var seqs []int64
+	for seq := first; seq <= last; seq++ {
+		seqs = append(seqs, seq)
+	}
+	return seqs
+}
+
+// equalSeqs reports whether a and b hold the same seqs in the same order
+func equalSeqs(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
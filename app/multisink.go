@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// fanoutBuffer is how many entries each output of a multiSink may fall behind by
+const fanoutBuffer = 1024
+
+// fanoutStall is how long a multiSink waits for a full output before treating it as stalled
+const fanoutStall = time.Second
+
+// fanoutTimeout bounds how long Flush, Reopen and Close wait for a single output
+const fanoutTimeout = 10 * time.Second
+
+// multiSink writes every entry to several sinks, e.g. a file for Fluent Bit and stdout for
+// kubectl logs. Each output is fed by its own goroutine through a bounded buffer, so one that
+// is slow or failing neither blocks nor breaks the others. Writes wait for a full output for up
+// to fanoutStall, so a fast generator is held back to the pace of the slowest healthy output;
+// after that the output counts as stalled and misses entries until it has caught up by half
+// its buffer. An output failing on its own is logged and the others carry on; writes only
+// fail once every output is failing or stalled
+type multiSink struct {
+	outputs []*fanout
+}
+
+// fanout is one output of a multiSink and the goroutine writing to it
+type fanout struct {
+	name    string
+	ops     chan fanoutOp
+	closed  chan error  // Receives the result of closing the sink once ops is drained
+	stalled bool        // Whether entries for this output are being dropped
+	failing atomic.Bool // Whether the latest write to this output failed
+}
+
+// fanoutOp is an entry to write or, if do is set, an operation on the sink
+// If reply is set, the result of the write or operation is sent to it
+type fanoutOp struct {
+	entry LogEntry
+	do    func(Sink) error
+	reply chan error
+}
+
+// newMultiSink starts a writer goroutine for each of sinks, named by names in messages
+func newMultiSink(names []string, sinks []Sink) *multiSink {
+	m := &multiSink{}
+	for i, sink := range sinks {
+		f := &fanout{name: names[i], ops: make(chan fanoutOp, fanoutBuffer), closed: make(chan error, 1)}
+		go f.run(sink)
+		m.outputs = append(m.outputs, f)
+	}
+	return m
+}
+
+// run writes queued entries to sink until ops is closed, then closes sink
+func (f *fanout) run(sink Sink) {
+	failing := false
+	for op := range f.ops {
+		if op.do != nil {
+			op.reply <- op.do(sink)
+			continue
+		}
+		err := sink.Write(op.entry)
+		switch {
+		case err != nil && !failing:
+			log.Printf("warning: output %s: %v; other outputs carry on", f.name, err)
+		case err == nil && failing:
+			log.Printf("Output %s writable again", f.name)
+		}
+		failing = err != nil
+		f.failing.Store(failing)
+		if op.reply != nil {
+			op.reply <- err // Counted by whoever is waiting for it
+		} else if err != nil {
+			logWriteErrors.Add(1)
+		}
+	}
+	f.closed <- sink.Close()
+}
+
+// enqueue queues op unless the output is stalled, reporting whether it did
+// Entries dropped for a stalled output are counted in log_output_dropped_total
+func (f *fanout) enqueue(op fanoutOp) bool {
+	if f.stalled {
+		if len(f.ops) > fanoutBuffer/2 {
+			logOutputDropped.Add(1)
+			return false
+		}
+		f.stalled = false
+		log.Printf("Output %s caught up", f.name)
+	}
+	select {
+	case f.ops <- op:
+		return true
+	default:
+	}
+	timer := time.NewTimer(fanoutStall)
+	defer timer.Stop()
+	select {
+	case f.ops <- op:
+		return true
+	case <-timer.C:
+		f.stalled = true
+		logOutputDropped.Add(1)
+		log.Printf("warning: output %s has not kept up for %s, dropping entries for it until it does", f.name, fanoutStall)
+		return false
+	}
+}
+
+// Write implements Sink, queueing entry for every output that is keeping up
+// While any output is healthy it returns straight away and only ever fails once none is: from
+// then on it waits for entry to be written, failing with every output's error if none took
+// it, so -max-write-failures, the pause while the disk is full and /healthz see the outage
+func (m *multiSink) Write(entry LogEntry) error {
+	wait := m.failing()
+	replies := make([]chan error, len(m.outputs))
+	var errs []error
+	for i, f := range m.outputs {
+		op := fanoutOp{entry: entry}
+		if wait {
+			op.reply = make(chan error, 1)
+		}
+		if !f.enqueue(op) {
+			errs = append(errs, fmt.Errorf("output %s: not keeping up, entry dropped", f.name))
+			continue
+		}
+		replies[i] = op.reply
+	}
+	if !wait {
+		return nil
+	}
+
+	failed := 0 // Outputs that took entry but could not write it
+	for i, reply := range replies {
+		if reply == nil {
+			continue
+		}
+		select {
+		case err := <-reply:
+			if err == nil {
+				continue
+			}
+			errs = append(errs, fmt.Errorf("output %s: %w", m.outputs[i].name, err))
+		case <-time.After(fanoutTimeout):
+			errs = append(errs, fmt.Errorf("output %s: not responding", m.outputs[i].name))
+		}
+		failed++
+	}
+	if len(errs) < len(m.outputs) {
+		logWriteErrors.Add(int64(failed)) // The entry got through, but not everywhere
+		return nil
+	}
+	return errors.Join(errs...)
+}
+
+// failing reports whether no output is currently taking entries, each being stalled or
+// having failed its latest write
+func (m *multiSink) failing() bool {
+	for _, f := range m.outputs {
+		if !f.stalled && !f.failing.Load() {
+			return false
+		}
+	}
+	return true
+}
+
+// do runs fn on every output after the entries already queued for it, returning the
+// errors joined; an output that does not respond within fanoutTimeout counts as failed
+func (m *multiSink) do(fn func(Sink) error) error {
+	replies := make([]chan error, len(m.outputs))
+	var errs []error
+	for i, f := range m.outputs {
+		replies[i] = make(chan error, 1)
+		select {
+		case f.ops <- fanoutOp{do: fn, reply: replies[i]}:
+		case <-time.After(fanoutTimeout):
+			errs = append(errs, fmt.Errorf("output %s: not responding", f.name))
+			replies[i] = nil
+		}
+	}
+	for i, reply := range replies {
+		if reply == nil {
+			continue
+		}
+		select {
+		case err := <-reply:
+			if err != nil {
+				errs = append(errs, fmt.Errorf("output %s: %w", m.outputs[i].name, err))
+			}
+		case <-time.After(fanoutTimeout):
+			errs = append(errs, fmt.Errorf("output %s: not responding", m.outputs[i].name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Flush implements Sink
+func (m *multiSink) Flush() error {
+	return m.do(Sink.Flush)
+}
+
+// Reopen implements reopener for the outputs that support it
+func (m *multiSink) Reopen() error {
+	return m.do(func(s Sink) error {
+		if r, ok := s.(reopener); ok {
+			return r.Reopen()
+		}
+		return nil
+	})
+}
+
+// Close implements Sink, writing out every queued entry before closing each output
+func (m *multiSink) Close() error {
+	for _, f := range m.outputs {
+		close(f.ops)
+	}
+	var errs []error
+	for _, f := range m.outputs {
+		select {
+		case err := <-f.closed:
+			if err != nil {
+				errs = append(errs, fmt.Errorf("output %s: %w", f.name, err))
+			}
+		case <-time.After(fanoutTimeout):
+			errs = append(errs, fmt.Errorf("output %s: not responding, entries may be lost", f.name))
+		}
+	}
+	return errors.Join(errs...)
+}
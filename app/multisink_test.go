@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+)
+
+// errSink is a Sink whose writes all return err, succeeding if it is nil
+type errSink struct {
+	err error
+}
+
+func (s errSink) Write(LogEntry) error { return s.err }
+func (s errSink) Flush() error         { return nil }
+func (s errSink) Close() error         { return nil }
+
+// TestMultiSinkFailsOnlyWhenEveryOutputFails checks that one broken output is ridden out,
+// while an outage of every output reaches the caller with each output's error
+func TestMultiSinkFailsOnlyWhenEveryOutputFails(t *testing.T) {
+	tests := []struct {
+		name    string
+		sinks   []Sink
+		wantErr bool
+	}{
+		{"one of two failing", []Sink{errSink{syscall.ENOSPC}, errSink{}}, false},
+		{"both failing", []Sink{errSink{syscall.ENOSPC}, errSink{syscall.EACCES}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMultiSink([]string{"a", "b"}, tt.sinks)
+			defer m.Close()
+
+			// The first write is queued before anything has failed, so only the next one can tell
+			if err := m.Write(LogEntry{Message: "first"}); err != nil {
+				t.Fatalf("first write: %v", err)
+			}
+			if err := m.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			err := m.Write(LogEntry{Message: "second"})
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("second write: %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, syscall.ENOSPC) || !errors.Is(err, syscall.EACCES) {
+				t.Fatalf("second write: %v, want both outputs' errors", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OTLP output configuration (-output=otlp); batching and retries follow the -http-* settings
+var (
+	otlpEndpoint = "http://localhost:4318/v1/logs" // OTLP/HTTP logs URL of a collector or backend
+	otlpHeaders  = headerList{}                    // Extra headers sent with every export, e.g. authorization
+)
+
+// otlpScope names the instrumentation scope every exported record belongs to
+const otlpScope = "log-generator"
+
+// headerList is a flag.Value for comma-separated key=value HTTP headers, in the format of
+// OTEL_EXPORTER_OTLP_HEADERS
+type headerList [][2]string
+
+// String implements flag.Value; values are left out since they are usually credentials
+func (h *headerList) String() string {
+	keys := make([]string, len(*h))
+	for i, kv := range *h {
+		keys[i] = kv[0]
+	}
+	return strings.Join(keys, ",")
+}
+
+// Set implements flag.Value
+func (h *headerList) Set(value string) error {
+	var list headerList
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		if k = strings.TrimSpace(k); !ok || k == "" {
+			return fmt.Errorf("%q is not a key=value header", pair)
+		}
+		list = append(list, [2]string{k, strings.TrimSpace(v)})
+	}
+	*h = list
+	return nil
+}
+
+// startOTLPSink starts a sink exporting entries to otlpEndpoint as OTLP/HTTP JSON
+// export requests, one resource per service
+func startOTLPSink() *httpSink {
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	for _, kv := range otlpHeaders {
+		header.Set(kv[0], kv[1])
+	}
+	return startBatchSink(otlpEndpoint, header, encodeOTLPRecord, otlpBody)
+}
+
+// otlpKeyValue is an OTLP attribute; value holds one of stringValue, intValue or boolValue
+type otlpKeyValue struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+// otlpLogRecord is an OTLP LogRecord in the protobuf JSON mapping: 64-bit integers are
+// strings and trace and span IDs are hex
+type otlpLogRecord struct {
+	TimeUnixNano         string                 `json:"timeUnixNano"`
+	ObservedTimeUnixNano string                 `json:"observedTimeUnixNano"`
+	SeverityNumber       int                    `json:"severityNumber"`
+	SeverityText         string                 `json:"severityText"`
+	Body                 map[string]interface{} `json:"body"`
+	Attributes           []otlpKeyValue         `json:"attributes,omitempty"`
+	TraceID              string                 `json:"traceId,omitempty"`
+	SpanID               string                 `json:"spanId,omitempty"`
+}
+
+// otlpValue wraps v as an OTLP AnyValue
+func otlpValue(v interface{}) map[string]interface{} {
+	switch v := v.(type) {
+	case int:
+		return map[string]interface{}{"intValue": strconv.Itoa(v)}
+	case int64:
+		return map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+	case bool:
+		return map[string]interface{}{"boolValue": v}
+	}
+	return map[string]interface{}{"stringValue": fmt.Sprint(v)}
+}
+
+// otlpResource returns the OTLP semantic-convention resource attributes describing where
+// entry came from
+func otlpResource(entry LogEntry) []otlpKeyValue {
+	attrs := []otlpKeyValue{{"service.name", otlpValue(entry.Service)}}
+	for _, kv := range []struct{ key, value string }{
+		{"service.version", entry.Version},
+		{"deployment.environment", entry.Env},
+		{"host.name", entry.Hostname},
+		{"k8s.pod.name", entry.PodName},
+	} {
+		if kv.value != "" {
+			attrs = append(attrs, otlpKeyValue{kv.key, otlpValue(kv.value)})
+		}
+	}
+	return attrs
+}
+
+// encodeOTLPRecord converts entry into an OTLP LogRecord: level becomes the severity, the
+// message the body, and every other populated field an attribute named as in the JSON
+// output, with custom attributes under their own keys. The resource is kept alongside
+func encodeOTLPRecord(entry LogEntry) (batchRecord, error) {
+	record := otlpLogRecord{
+		ObservedTimeUnixNano: strconv.FormatInt(time.Now().UnixNano(), 10),
+		SeverityNumber:       entry.SeverityNumber,
+		SeverityText:         string(entry.Level),
+		Body:                 otlpValue(entry.Message),
+		TraceID:              entry.TraceID,
+		SpanID:               entry.SpanID,
+	}
+	if t, ok := parseEntryTime(entry.Timestamp); ok {
+		record.TimeUnixNano = strconv.FormatInt(t.UnixNano(), 10)
+	} else {
+		record.TimeUnixNano = record.ObservedTimeUnixNano
+	}
+	for _, f := range entryFields(entry) {
+		switch f.key {
+		case "timestamp", "level", "severity_number", "message", "trace_id", "span_id",
+			"service", "service_version", "env", "hostname", "pod_name": // Carried above or by the resource
+			continue
+		}
+		key := fieldKey(f.key)
+		if k, ok := strings.CutPrefix(f.key, "attributes."); ok {
+			key = k
+		}
+		record.Attributes = append(record.Attributes, otlpKeyValue{key, otlpValue(f.value)})
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return batchRecord{}, err
+	}
+	resource, err := json.Marshal(otlpResource(entry))
+	if err != nil {
+		return batchRecord{}, err
+	}
+	return batchRecord{data: data, resource: string(resource)}, nil
+}
+
+// otlpBody builds an ExportLogsServiceRequest from batch, grouping records by resource in
+// the order each resource first appears
+func otlpBody(batch []batchRecord) ([]byte, error) {
+	type scopeLogs struct {
+		Scope      map[string]string `json:"scope"`
+		LogRecords []json.RawMessage `json:"logRecords"`
+	}
+	type resourceLogs struct {
+		Resource  map[string]json.RawMessage `json:"resource"`
+		ScopeLogs []scopeLogs                `json:"scopeLogs"`
+	}
+	var request struct {
+		ResourceLogs []*resourceLogs `json:"resourceLogs"`
+	}
+	byResource := map[string]*resourceLogs{}
+	for _, r := range batch {
+		rl, ok := byResource[r.resource]
+		if !ok {
+			rl = &resourceLogs{
+				Resource:  map[string]json.RawMessage{"attributes": json.RawMessage(r.resource)},
+				ScopeLogs: []scopeLogs{{Scope: map[string]string{"name": otlpScope}}},
+			}
+			byResource[r.resource] = rl
+			request.ResourceLogs = append(request.ResourceLogs, rl)
+		}
+		rl.ScopeLogs[0].LogRecords = append(rl.ScopeLogs[0].LogRecords, r.data)
+	}
+	return json.Marshal(request)
+}
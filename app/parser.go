@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+)
+
+// printParser writes a Fluent Bit [PARSER] stanza matching the current LogEntry
+// schema, output format and timestamp format, ready to paste into parsers.conf
+func printParser(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 4, 1, ' ', 0)
+	defer tw.Flush()
+
+	fmt.Fprintf(tw, "# Generated by -print-parser for -format=%s -timestamp-format=%s\n", logFormat, timestampFormat)
+	if logFormat == formatJSONArray {
+		fmt.Fprintln(tw, "# Note: the tail input reads one record per line, so json-array files need an input that")
+		fmt.Fprintln(tw, "# reads whole documents; the parser below describes each array element")
+	}
+	fmt.Fprintln(tw, "[PARSER]")
+	fmt.Fprintf(tw, "    Name\tgo_app_%s\n", strings.ReplaceAll(logFormat, "-", "_"))
+
+	switch logFormat {
+	case formatLogfmt:
+		fmt.Fprintln(tw, "    Format\tlogfmt")
+	case formatPlain:
+		fmt.Fprintln(tw, "    Format\tregex")
+		fmt.Fprintf(tw, "    Regex\t%s\n", plainRegex())
+	case formatSyslog:
+		// Same shape as Fluent Bit's bundled syslog-rfc5424 parser, with the LogEntry field names
+		fmt.Fprintln(tw, "    Format\tregex")
+		fmt.Fprintf(tw, "    Regex\t%s\n", `^\<(?<pri>[0-9]{1,5})\>1 (?<timestamp>[^ ]+) (?<hostname>[^ ]+) (?<service>[^ ]+) (?<pid>[-0-9]+) (?<msgid>[^ ]+) (?<extradata>(\[(.*?)\]|-)) (?<message>.+)$`)
+	default:
+		fmt.Fprintln(tw, "    Format\tjson")
+	}
+
+	timeKey := "timestamp"
+	if logFormat == formatECS {
+		timeKey = "@timestamp"
+	}
+	timeFormat, timeOK := parserTimeFormat()
+	if timeOK {
+		fmt.Fprintf(tw, "    Time_Key\t%s\n", timeKey)
+		fmt.Fprintf(tw, "    Time_Format\t%s\n", timeFormat)
+	}
+
+	// JSON keeps numbers typed on its own, and in plain lines the numeric fields are
+	// part of the trailing "fields" capture, so only logfmt needs explicit conversions
+	if logFormat == formatLogfmt {
+		if types := parserTypes(); types != "" {
+			fmt.Fprintf(tw, "    Types\t%s\n", types)
+		}
+	}
+
+	if !timeOK {
+		fmt.Fprintf(tw, "    # %s timestamps cannot be parsed as the record time, so the field is kept as-is\n", timestampFormat)
+	}
+}
+
+// parserTimeFormat returns the strptime format Fluent Bit should use for the timestamp field,
+// or false when the encoding isn't one Fluent Bit can parse
+func parserTimeFormat() (string, bool) {
+	if logFormat == formatSyslog && timestampFormat != timestampRFC3339 {
+		return "%Y-%m-%dT%H:%M:%S.%L%z", true // syslogTimestamp turns epoch values back into RFC 3339
+	}
+	switch timestampFormat {
+	case timestampRFC3339:
+		return "%Y-%m-%dT%H:%M:%S%z", true
+	case timestampRFC3339Nano:
+		return "%Y-%m-%dT%H:%M:%S.%L%z", true
+	}
+	return "", false
+}
+
+// parserTypes lists the integer-valued LogEntry fields as Fluent Bit "key:integer" type hints
+func parserTypes() string {
+	var types []string
+	t := reflect.TypeOf(LogEntry{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		switch t.Field(i).Type.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			types = append(types, fieldKey(name)+":integer")
+		}
+	}
+	return strings.Join(types, " ")
+}
+
+// plainRegex builds a regex matching formatPlainLine output. The message ends where the
+// first trailing key=value field begins; those fields are captured together as "fields",
+// which a follow-up logfmt parser filter can expand if needed
+func plainRegex() string {
+	var keys []string
+	t := reflect.TypeOf(LogEntry{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		switch {
+		case name == "" || name == "-" || name == "timestamp" || name == "level" || name == "service" || name == "message":
+		case t.Field(i).Type.Kind() == reflect.Map:
+			keys = append(keys, fieldKey(name)+`\.[^=\s]+`) // Flattened to one key per map entry
+		default:
+			keys = append(keys, fieldKey(name))
+		}
+	}
+	return fmt.Sprintf(`^(?<timestamp>\S+) (?<level>\S+)\s+\[(?<service>[^\]]*)\] (?<message>.*?)(?: (?<fields>(?:%s)=.*))?$`, strings.Join(keys, "|"))
+}
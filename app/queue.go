@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+)
+
+// Policies for a full write queue, selectable with -queue-policy
+const (
+	queueBlock      = "block"       // Generation waits for the writer, as without a queue
+	queueDropOldest = "drop-oldest" // The oldest queued entry is discarded to make room
+)
+
+// Write queue configuration (-queue-size, -queue-policy)
+var (
+	queueSize   = 0 // Entries buffered between generation and writing (0 writes inline)
+	queuePolicy = queueBlock
+)
+
+// logQueue is the active write queue, or nil when entries are written inline
+var logQueue *entryQueue
+
+// entryQueue decouples generation from writing through a bounded channel, so a slow
+// output sheds load according to the policy instead of always stalling the generators
+type entryQueue struct {
+	entries chan LogEntry
+	policy  string
+	done    chan struct{} // Closed once the writer has drained entries
+}
+
+// startQueue starts the writer goroutine, which writes queued entries through logger in order
+func startQueue(ctx context.Context, logger *Logger, size int, policy string) *entryQueue {
+	q := &entryQueue{entries: make(chan LogEntry, size), policy: policy, done: make(chan struct{})}
+	go func() {
+		defer close(q.done)
+		for entry := range q.entries {
+			writeEntry(ctx, logger, entry)
+		}
+	}()
+	return q
+}
+
+// push queues entry, applying the policy when the queue is full
+func (q *entryQueue) push(entry LogEntry) {
+	if q.policy == queueBlock {
+		q.entries <- entry
+		return
+	}
+	for {
+		select {
+		case q.entries <- entry:
+			return
+		default:
+		}
+		select {
+		case <-q.entries:
+			logQueueDropped.Add(1)
+		default: // The writer took one in the meantime; try again
+		}
+	}
+}
+
+// close waits for every queued entry to be written; push must not be called afterwards
+func (q *entryQueue) close() {
+	close(q.entries)
+	<-q.done
+}
+
+// submit hands entry to the write queue, or writes it straight away when there is none
+func submit(ctx context.Context, logger *Logger, entry LogEntry) {
+	if logQueue != nil {
+		logQueue.push(entry)
+		return
+	}
+	writeEntry(ctx, logger, entry)
+}
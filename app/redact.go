@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Strategies for -redact-strategy
+const (
+	redactMask = "mask" // Replace the value with redactedMask
+	redactHash = "hash" // Replace the value with a short SHA-256 digest, so equal values still correlate
+)
+
+// redactedMask is what a masked value is replaced with
+const redactedMask = "***"
+
+var (
+	redactFields   = ""         // Comma-separated JSON names of the fields to redact, e.g. user_id,attributes.plan
+	redactStrategy = redactMask // How -redact-fields values are replaced
+	redactor       *redaction   // Compiled from the two above at startup; nil redacts nothing
+)
+
+// redaction rewrites sensitive fields of entries before they reach the sink, to show PII
+// being handled before logs leave the host
+type redaction struct {
+	fields     []int    // Indexes of string fields of LogEntry to redact
+	attributes []string // Attribute keys to redact
+	hash       bool     // Hash rather than mask
+}
+
+// parseRedaction compiles a comma-separated list of field names for strategy. Top-level
+// fields are named as in the JSON output (user_id) and attributes as attributes.<key>
+func parseRedaction(list, strategy string) (*redaction, error) {
+	if strategy != redactMask && strategy != redactHash {
+		return nil, fmt.Errorf("unknown strategy %q: must be mask or hash", strategy)
+	}
+	r := &redaction{hash: strategy == redactHash}
+	t := reflect.TypeOf(LogEntry{})
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if key, ok := strings.CutPrefix(name, "attributes."); ok && key != "" {
+			r.attributes = append(r.attributes, key)
+			continue
+		}
+		i := jsonFieldIndex(t, name)
+		if i < 0 {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+		if t.Field(i).Type.Kind() != reflect.String {
+			return nil, fmt.Errorf("field %q is not a string and cannot be redacted", name)
+		}
+		r.fields = append(r.fields, i)
+	}
+	return r, nil
+}
+
+// jsonFieldIndex returns the index of the field of struct type t whose JSON name is name, or -1
+func jsonFieldIndex(t reflect.Type, name string) int {
+	for i := 0; i < t.NumField(); i++ {
+		tag, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if tag == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// apply redacts the configured fields of entry; empty values are left empty
+// Attributes are copied first, since the map may be shared with other entries
+func (r *redaction) apply(entry *LogEntry) {
+	v := reflect.ValueOf(entry).Elem()
+	for _, i := range r.fields {
+		if f := v.Field(i); f.String() != "" {
+			f.SetString(r.replace(f.String()))
+		}
+	}
+	if len(r.attributes) == 0 || len(entry.Attributes) == 0 {
+		return
+	}
+	attrs := make(map[string]string, len(entry.Attributes))
+	for k, val := range entry.Attributes {
+		attrs[k] = val
+	}
+	for _, key := range r.attributes {
+		if val, ok := attrs[key]; ok && val != "" {
+			attrs[key] = r.replace(val)
+		}
+	}
+	entry.Attributes = attrs
+}
+
+// replace returns the redacted form of value
+// Hashes are unsalted, so they keep entries for the same value joinable but are only
+// pseudonymous: a small set such as user IDs can be recovered by hashing every candidate
+func (r *redaction) replace(value string) string {
+	if !r.hash {
+		return redactedMask
+	}
+	sum := sha256.Sum256([]byte(value))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
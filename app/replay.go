@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Replay configuration (-replay)
+var (
+	replayFile  = ""  // JSON lines log file to re-emit instead of generating entries
+	replaySpeed = 1.0 // Time scale for the gaps between replayed entries (2 replays twice as fast)
+)
+
+// replay re-emits the JSON lines entries of path through logger, reproducing the original
+// gaps between their timestamps divided by replaySpeed. Each entry is re-stamped as it is
+// written, so the replayed pattern starts now. Lines that are not valid entries are skipped
+func replay(ctx context.Context, logger *Logger, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024) // Full stack traces can make long lines
+	var prev time.Time
+	lineNo := 0
+	for scanner.Scan() && ctx.Err() == nil && !entryLimitReached() {
+		lineNo++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var entry LogEntry
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.UseNumber() // Keep epoch timestamps exact
+		if err := dec.Decode(&entry); err != nil {
+			log.Printf("warning: skipping %s:%d: %v", path, lineNo, err)
+			continue
+		}
+
+		// Entries without a readable timestamp are replayed straight after the previous one
+		if at, ok := parseEntryTime(entry.Timestamp); ok {
+			if !prev.IsZero() && at.After(prev) {
+				if !logger.clock.Sleep(ctx, time.Duration(float64(at.Sub(prev))/replaySpeed)) {
+					return nil
+				}
+			}
+			prev = at
+		}
+		if !reserveEntry() {
+			break
+		}
+		submit(ctx, logger, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read %s: %w", path, err)
+	}
+	return nil
+}
+
+// parseEntryTime reads a timestamp in any -timestamp-format encoding
+// Epoch values are told apart by magnitude: nanoseconds exceed 1e15 for any date after 1970-01-12
+func parseEntryTime(ts interface{}) (time.Time, bool) {
+	switch v := ts.(type) {
+	case int64: // As stamped by Logger for the epoch formats
+		if timestampFormat == timestampEpochNanos {
+			return time.Unix(0, v), true
+		}
+		return time.UnixMilli(v), true
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		return t, err == nil
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		if n > 1e15 {
+			return time.Unix(0, n), true
+		}
+		return time.UnixMilli(n), true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// utcDay returns the UTC calendar day of t, e.g. 2024-06-01
+func utcDay(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// splitLogName splits path into its stem and extension: /var/log/app.log -> /var/log/app, .log
+func splitLogName(path string) (string, string) {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext), ext
+}
+
+// datedName returns the name for path rotated after being started at created, e.g.
+// app-2024-06-01.log. Further rotations on the same day (by size or -rotate-interval)
+// get app-2024-06-01.1.log, app-2024-06-01.2.log, ... rather than replacing it
+func datedName(path string, created time.Time) string {
+	stem, ext := splitLogName(path)
+	day := utcDay(created)
+	for i := 0; ; i++ {
+		name := fmt.Sprintf("%s-%s%s", stem, day, ext)
+		if i > 0 {
+			name = fmt.Sprintf("%s-%s.%d%s", stem, day, i, ext)
+		}
+		if !exists(name) && !exists(name+".gz") {
+			return name
+		}
+	}
+}
+
+// exists reports whether path is present
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// datedRotated returns the dated rotated files of path, plain or gzipped, newest first
+func datedRotated(path string) []string {
+	stem, ext := splitLogName(path)
+	pattern := regexp.MustCompile(`^` + regexp.QuoteMeta(filepath.Base(stem)) + `-\d{4}-\d{2}-\d{2}(\.\d+)?` + regexp.QuoteMeta(ext) + `(\.gz)?$`)
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return nil
+	}
+	type rotatedFile struct {
+		path    string
+		modTime time.Time
+	}
+	var files []rotatedFile
+	for _, e := range entries {
+		if !pattern.MatchString(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, rotatedFile{filepath.Join(filepath.Dir(path), e.Name()), info.ModTime()})
+	}
+	// Modification time rather than name, since app-2024-06-01.1.log sorts before app-2024-06-01.log
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.After(files[j].modTime) })
+	out := make([]string, len(files))
+	for i, f := range files {
+		out[i] = f.path
+	}
+	return out
+}
+
+// pruneDated applies retention to the dated rotated files of path: only the newest maxFiles
+// are kept and, if maxAge is set, none last written more than maxAge before now. Each file's
+// .meta sidecar goes with it
+func pruneDated(path string, maxFiles int, maxAge time.Duration, now time.Time) {
+	for i, rotated := range datedRotated(path) {
+		if i < maxFiles {
+			if info, err := os.Stat(rotated); maxAge <= 0 || err != nil || now.Sub(info.ModTime()) < maxAge {
+				continue
+			}
+		}
+		meta := strings.TrimSuffix(rotated, ".gz") + ".meta"
+		for _, name := range []string{rotated, meta} {
+			if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+				log.Printf("warning: failed to remove expired rotated log %s: %v", name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// workers is the number of concurrent generator goroutines
+var workers = 1
+
+// newSource creates a generator worker's random source from its seed. It is a variable so
+// tests can count the calls: each worker seeds once, never per iteration
+var newSource = rand.NewSource
+
+// run generates logs on workers goroutines until ctx is done or maxEntries is reached
+// Each worker has its own random source, derived from seed, since *rand.Rand is not safe for
+// concurrent use; all of them write through the same Logger and share one pacer
+func run(ctx context.Context, logger *Logger, workers int) {
+	var p pacer
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		rng := rand.New(newSource(seed + int64(i)))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gen := newGenerator(rng, logger.clock)
+			for ctx.Err() == nil && !entryLimitReached() {
+				n, more := writeIteration(ctx, logger, gen)
+				if !more {
+					return // The generator has nothing left to write
+				}
+				logger.clock.Sleep(ctx, p.delay(rng, n, logger.clock.Now()))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// pacer spaces out generation so -rate and -burst hold for the combined output of all workers
+type pacer struct {
+	mu         sync.Mutex
+	next       time.Time // Earliest time any worker may start its next iteration
+	burstCount int       // Entries emitted in the current burst
+}
+
+// delay returns how long a worker should wait after an iteration that emitted n entries,
+// finishing at now
+func (p *pacer) delay(rng *rand.Rand, n int, now time.Time) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.next.Before(now) {
+		p.next = now // Idle time is not saved up for a later burst of catching up
+	}
+	switch {
+	case burstSize > 0:
+		// Burst mode: no pause until a full burst has been emitted, then every worker pauses
+		p.burstCount += n
+		if p.burstCount >= burstSize {
+			p.burstCount = 0
+			p.next = p.next.Add(burstPause)
+		}
+	case rate > 0:
+		// Reserve time for the entries just written on the shared schedule to hold the target rate
+		p.next = p.next.Add(time.Duration(float64(n) / rate * float64(time.Second)))
+	default:
+		return time.Duration(rng.Intn(3)+1) * time.Second // 1-3 second intervals, per worker
+	}
+	return p.next.Sub(now)
+}
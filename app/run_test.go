@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lockedClock is a fakeClock that several workers can share
+type lockedClock struct {
+	mu sync.Mutex
+	fakeClock
+}
+
+func (c *lockedClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.fakeClock.Now()
+}
+
+func (c *lockedClock) Sleep(ctx context.Context, d time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.fakeClock.Sleep(ctx, d)
+}
+
+// TestRunSeedsOncePerWorker checks that each generator worker seeds its random source once,
+// at startup, however many iterations it goes on to generate
+func TestRunSeedsOncePerWorker(t *testing.T) {
+	defer func(orig func(int64) rand.Source, limit int64) {
+		newSource, maxEntries = orig, limit
+		totalEmitted.Store(0)
+	}(newSource, maxEntries)
+
+	for _, workers := range []int{1, 4} {
+		var mu sync.Mutex
+		seeds := map[int64]int{}
+		newSource = func(seed int64) rand.Source {
+			mu.Lock()
+			defer mu.Unlock()
+			seeds[seed]++
+			return rand.NewSource(seed)
+		}
+		maxEntries = 500 // Dozens of iterations per worker
+		totalEmitted.Store(0)
+
+		clock := &lockedClock{fakeClock: fakeClock{now: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}}
+		run(context.Background(), NewLogger(newWriterSink(io.Discard), clock), workers)
+
+		if got := totalEmitted.Load(); got != maxEntries {
+			t.Fatalf("%d workers emitted %d entries, want %d", workers, got, maxEntries)
+		}
+		if len(seeds) != workers {
+			t.Errorf("%d workers seeded %d sources, want one each: %v", workers, len(seeds), seeds)
+		}
+		for s, calls := range seeds {
+			if calls != 1 {
+				t.Errorf("seed %d used %d times, want once", s, calls)
+			}
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// scenarioFile is a YAML file describing a whole generation profile (see scenario)
+var scenarioFile = ""
+
+// scenario is the layout of a -scenario file, e.g.
+//
+//	rate: 20
+//	level_weights: {ERROR: 40, WARN: 30, INFO: 30}
+//	region: eu-west-1
+//	incidents: {every: 5m, duration: 1m}
+//	endpoints: [/api/orders, /api/payments]
+//
+// Each setting stands in for the flag of the same name (level_weights for -level-weights,
+// incidents.every for -incident-every, ...), and the sample arrays and messages for those of
+// a -seed-data file. Settings left out keep their defaults, and flags given on the command
+// line override the file, so one scenario can be reused with small variations
+type scenario struct {
+	Rate               *float64           `yaml:"rate"`
+	Burst              *int               `yaml:"burst"`
+	BurstPause         string             `yaml:"burst_pause"`
+	Workers            *int               `yaml:"workers"`
+	LevelWeights       map[string]float64 `yaml:"level_weights"`
+	MinLevel           string             `yaml:"min_level"`
+	Sample             map[string]int     `yaml:"sample"`
+	LatencyDist        string             `yaml:"latency_dist"`
+	Region             string             `yaml:"region"`
+	Env                string             `yaml:"env"`
+	Version            string             `yaml:"version"`
+	DedupWindow        string             `yaml:"dedup_window"`
+	MinErrorsPerMinute *int               `yaml:"min_errors_per_minute"`
+	Duration           string             `yaml:"duration"`
+	MaxEntries         *int64             `yaml:"max_entries"`
+	Seed               *int64             `yaml:"seed"`
+	Incidents          struct {
+		Every    string `yaml:"every"`
+		Duration string `yaml:"duration"`
+	} `yaml:"incidents"`
+
+	Users      []string          `yaml:"users"`
+	Endpoints  []string          `yaml:"endpoints"`
+	Regions    []string          `yaml:"regions"`
+	Components []string          `yaml:"components"`
+	Services   []string          `yaml:"services"`
+	Messages   map[string]string `yaml:"messages"`
+	Backends   map[string]string `yaml:"backends"`
+}
+
+// scenarioFlags names the flags of scenario keys whose names do not simply map to the flag's
+// by turning underscores into dashes
+var scenarioFlags = map[string]string{
+	"incidents.every":    "incident-every",
+	"incidents.duration": "incident-duration",
+}
+
+// flagValues returns the settings of the scenario that stand in for flags, by key, in the
+// flags' own syntax
+func (s *scenario) flagValues() map[string]string {
+	values := map[string]string{}
+	set := func(key, value string) {
+		if value != "" {
+			values[key] = value
+		}
+	}
+	if s.Rate != nil {
+		set("rate", strconv.FormatFloat(*s.Rate, 'g', -1, 64))
+	}
+	if s.Burst != nil {
+		set("burst", strconv.Itoa(*s.Burst))
+	}
+	set("burst_pause", s.BurstPause)
+	if s.Workers != nil {
+		set("workers", strconv.Itoa(*s.Workers))
+	}
+	set("level_weights", levelPairs(s.LevelWeights, func(w float64) string { return strconv.FormatFloat(w, 'g', -1, 64) }))
+	set("min_level", s.MinLevel)
+	set("sample", levelPairs(s.Sample, strconv.Itoa))
+	set("latency_dist", s.LatencyDist)
+	set("region", s.Region)
+	set("env", s.Env)
+	set("version", s.Version)
+	set("dedup_window", s.DedupWindow)
+	if s.MinErrorsPerMinute != nil {
+		set("min_errors_per_minute", strconv.Itoa(*s.MinErrorsPerMinute))
+	}
+	set("duration", s.Duration)
+	if s.MaxEntries != nil {
+		set("max_entries", strconv.FormatInt(*s.MaxEntries, 10))
+	}
+	if s.Seed != nil {
+		set("seed", strconv.FormatInt(*s.Seed, 10))
+	}
+	set("incidents.every", s.Incidents.Every)
+	set("incidents.duration", s.Incidents.Duration)
+	return values
+}
+
+// scenarioFlag returns the name of the flag scenario key stands in for
+func scenarioFlag(key string) string {
+	if name, ok := scenarioFlags[key]; ok {
+		return name
+	}
+	return strings.ReplaceAll(key, "_", "-")
+}
+
+// levelPairs renders a level-keyed map as the LEVEL=value list the flags take, sorted by level
+func levelPairs[V any](m map[string]V, format func(V) string) string {
+	pairs := make([]string, 0, len(m))
+	for level, v := range m {
+		pairs = append(pairs, level+"="+format(v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// applyScenario loads the scenario at path, setting every flag it covers that was not given
+// on the command line and switching to its sample arrays and messages
+// Unknown keys are rejected so a typo can't silently fall back to a default
+func applyScenario(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	s := scenario{}
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(&s); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	values := s.flagValues()
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys) // Report errors in a stable order
+	for _, key := range keys {
+		name := scenarioFlag(key)
+		if explicit[name] {
+			continue
+		}
+		if err := flag.Set(name, values[key]); err != nil {
+			return fmt.Errorf("%s: %s: %w", path, key, err)
+		}
+	}
+
+	data := currentSeedData()
+	for _, list := range []struct {
+		from []string
+		to   *[]string
+	}{
+		{s.Users, &data.Users},
+		{s.Endpoints, &data.Endpoints},
+		{s.Regions, &data.Regions},
+		{s.Components, &data.Components},
+		{s.Services, &data.Services},
+	} {
+		if list.from != nil {
+			*list.to = list.from
+		}
+	}
+	data.Messages, data.Backends = s.Messages, s.Backends
+	return applySeedData(data, path)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// jsonSchema is the subset of JSON Schema needed to describe flat log records:
+// type, enum, required, properties, additionalProperties, items, pattern,
+// minLength/maxLength and minimum/maximum. Unsupported keywords are ignored
+type jsonSchema struct {
+	Type                 schemaTypes            `json:"type"`
+	Enum                 []interface{}          `json:"enum"`
+	Required             []string               `json:"required"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	Pattern              string                 `json:"pattern"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+
+	pattern *regexp.Regexp // Compiled Pattern
+}
+
+// schemaTypes accepts both "type": "string" and "type": ["string", "integer"]
+type schemaTypes []string
+
+// UnmarshalJSON implements json.Unmarshaler
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaTypes{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("type must be a string or an array of strings")
+	}
+	*t = many
+	return nil
+}
+
+// entrySchema is loaded from -schema at startup; nil disables validation
+var entrySchema *jsonSchema
+
+// loadSchema reads and compiles the JSON Schema file at path
+func loadSchema(path string) (*jsonSchema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var schema jsonSchema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if err := schema.compile(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &schema, nil
+}
+
+// compile prepares regular expressions throughout the schema
+func (s *jsonSchema) compile() error {
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", s.Pattern, err)
+		}
+		s.pattern = re
+	}
+	for _, sub := range s.Properties {
+		if err := sub.compile(); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.compile()
+	}
+	return nil
+}
+
+// validateEntry checks the JSON representation of entry against schema and
+// returns every violation found, regardless of the configured output format
+func validateEntry(schema *jsonSchema, entry LogEntry) []string {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var doc interface{}
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.UseNumber() // Keep integers distinguishable from floats
+	if err := dec.Decode(&doc); err != nil {
+		return []string{err.Error()}
+	}
+	return schema.validate("$", doc, nil)
+}
+
+// validate appends a message for each way value at path violates s
+func (s *jsonSchema) validate(path string, value interface{}, errs []string) []string {
+	if len(s.Type) > 0 && !s.matchesType(value) {
+		return append(errs, fmt.Sprintf("%s: expected type %s, got %s", path, strings.Join(s.Type, " or "), jsonType(value)))
+	}
+	if len(s.Enum) > 0 && !s.inEnum(value) {
+		errs = append(errs, fmt.Sprintf("%s: %v is not one of the allowed values", path, value))
+	}
+
+	switch v := value.(type) {
+	case string:
+		n := len([]rune(v))
+		if s.MinLength != nil && n < *s.MinLength {
+			errs = append(errs, fmt.Sprintf("%s: length %d is shorter than %d", path, n, *s.MinLength))
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			errs = append(errs, fmt.Sprintf("%s: length %d is longer than %d", path, n, *s.MaxLength))
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			errs = append(errs, fmt.Sprintf("%s: %q does not match pattern %q", path, v, s.Pattern))
+		}
+	case json.Number:
+		f, _ := v.Float64()
+		if s.Minimum != nil && f < *s.Minimum {
+			errs = append(errs, fmt.Sprintf("%s: %s is less than minimum %g", path, v, *s.Minimum))
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			errs = append(errs, fmt.Sprintf("%s: %s is greater than maximum %g", path, v, *s.Maximum))
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				errs = append(errs, fmt.Sprintf("%s: missing required property %q", path, name))
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys) // Deterministic error order
+		for _, key := range keys {
+			if sub, ok := s.Properties[key]; ok {
+				errs = sub.validate(path+"."+key, v[key], errs)
+			} else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				errs = append(errs, fmt.Sprintf("%s: unexpected property %q", path, key))
+			}
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				errs = s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, errs)
+			}
+		}
+	}
+	return errs
+}
+
+// matchesType reports whether value satisfies any of the schema's types
+func (s *jsonSchema) matchesType(value interface{}) bool {
+	actual := jsonType(value)
+	for _, want := range s.Type {
+		if want == actual || (want == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// inEnum reports whether value equals one of the schema's enum values
+func (s *jsonSchema) inEnum(value interface{}) bool {
+	for _, allowed := range s.Enum {
+		if fmt.Sprint(allowed) == fmt.Sprint(value) && jsonType(allowed) == jsonType(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonType names the JSON Schema type of a decoded value
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if f, err := v.Float64(); err == nil && f == math.Trunc(f) && !strings.ContainsAny(v.String(), ".eE") {
+			return "integer"
+		}
+		return "number"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// seedData is the layout of a -seed-data file, e.g.
+//
+//	{"users": ["alice", "bob"], "regions": ["eu-central-1"],
+//	 "messages": {"ERROR": "{{.Component}} failed after {{.ResponseTime}}ms"},
+//	 "backends": {"/api/search": "search-service"}}
+//
+// Any array that is left out keeps its built-in default, as do levels without a message template
+// and endpoints without a backend
+type seedData struct {
+	Users      []string          `json:"users"`
+	Endpoints  []string          `json:"endpoints"`
+	Regions    []string          `json:"regions"`
+	Components []string          `json:"components"`
+	Services   []string          `json:"services"`
+	Messages   map[string]string `json:"messages"` // text/template message per level, over LogEntry
+	Backends   map[string]string `json:"backends"` // Backend service per endpoint, added to endpointBackends
+}
+
+// loadSeedData replaces the built-in sample arrays with those from the JSON file at path
+// Unknown keys and empty arrays are rejected so a typo can't silently fall back to defaults
+// or leave randomIteration with nothing to pick from
+func loadSeedData(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	data := currentSeedData()
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&data); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	return applySeedData(data, path)
+}
+
+// currentSeedData returns the sample arrays in use, as the defaults a seed-data file overrides
+func currentSeedData() seedData {
+	return seedData{
+		Users:      users,
+		Endpoints:  endpoints,
+		Regions:    regions,
+		Components: components,
+		Services:   services,
+	}
+}
+
+// applySeedData validates data, read from path, and switches generation over to it
+// Message templates are only replaced when data has some, keeping any loaded from -scenario
+func applySeedData(data seedData, path string) error {
+	for _, field := range []struct {
+		name   string
+		values []string
+	}{
+		{"users", data.Users},
+		{"endpoints", data.Endpoints},
+		{"regions", data.Regions},
+		{"components", data.Components},
+		{"services", data.Services},
+	} {
+		if len(field.values) == 0 {
+			return fmt.Errorf("%s: %q must not be empty", path, field.name)
+		}
+	}
+
+	templates, err := parseMessageTemplates(data.Messages)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	for endpoint, backend := range data.Backends {
+		if backend == "" {
+			return fmt.Errorf("%s: backend for %q must not be empty", path, endpoint)
+		}
+	}
+
+	users, endpoints, regions, components, services = data.Users, data.Endpoints, data.Regions, data.Components, data.Services
+	for endpoint, backend := range data.Backends {
+		endpointBackends[endpoint] = backend
+	}
+	if len(templates) > 0 {
+		messageTemplates = templates
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// selfMetricsInterval is how often the generator logs its own runtime stats (0 disables)
+var selfMetricsInterval = time.Duration(0)
+
+// selfMonitor writes an INFO entry with the generator's goroutine count and heap usage every
+// interval until ctx is done, as an example of an application logging its own health
+// The entries count towards -max-entries like any other
+func selfMonitor(ctx context.Context, logger *Logger, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if !reserveEntry() {
+			return
+		}
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+		goroutines := runtime.NumGoroutine()
+		entry := LogEntry{
+			Level:     LevelInfo,
+			Service:   "log-generator",
+			Component: "self-monitor",
+			Message:   fmt.Sprintf("Runtime stats: %d goroutines, %.1f MiB heap in use", goroutines, float64(mem.HeapAlloc)/(1<<20)),
+			Attributes: map[string]string{
+				"goroutines":       strconv.Itoa(goroutines),
+				"heap_alloc_bytes": strconv.FormatUint(mem.HeapAlloc, 10),
+				"gc_cycles":        strconv.FormatUint(uint64(mem.NumGC), 10),
+			},
+		}
+		if region != regionRandom {
+			entry.Region = region
+		}
+		annotate(&entry)
+		submit(ctx, logger, entry)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// selfTest checks that the log directory is writable and that entries survive a round trip
+// before generation starts, so a misconfigured volume fails fast with a clear message
+// instead of after a run of silent write failures. It writes one known entry to a scratch
+// file next to logFile, syncs it, reads it back and compares, leaving the real log untouched
+func selfTest() error {
+	probe := LogEntry{
+		Timestamp:      formatTimestamp(time.Now()),
+		Level:          LevelInfo,
+		SeverityNumber: severityNumber(LevelInfo),
+		Service:        "self-test",
+		Message:        "self-test \"quoted\" µ\nsecond line",
+		StatusCode:     200,
+		Hostname:       hostname,
+		Attributes:     map[string]string{"check": "round-trip"},
+	}
+	if _, err := formatEntry(probe); err != nil {
+		return fmt.Errorf("cannot serialize entries as %s: %w", logFormat, err)
+	}
+	want, err := json.Marshal(probe)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(logFile)
+	f, err := os.CreateTemp(dir, ".selftest-*")
+	if err != nil {
+		return fmt.Errorf("log directory %s is not writable: %w", dir, err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(append(want, '\n'))
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("write to %s: %w", dir, err)
+	}
+
+	got, err := os.ReadFile(f.Name())
+	if err != nil {
+		return fmt.Errorf("read back from %s: %w", dir, err)
+	}
+	var back LogEntry
+	dec := json.NewDecoder(bytes.NewReader(got))
+	dec.UseNumber() // Epoch nanoseconds would lose precision as a float64
+	if err := dec.Decode(&back); err != nil {
+		return fmt.Errorf("entry read back from %s does not parse: %w", dir, err)
+	}
+	// Compare re-encoded forms, since the timestamp decodes to a different Go type than it was written as
+	again, err := json.Marshal(back)
+	if err != nil || !bytes.Equal(again, want) {
+		return fmt.Errorf("entry read back from %s differs from what was written:\n  wrote %s\n  read  %s", dir, want, got)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// tailPollInterval is how often tail checks the log file for new entries and rotation
+const tailPollInterval = 250 * time.Millisecond
+
+// tailBacklog is how many existing entries tail prints before following, like tail -f
+const tailBacklog = 10
+
+// ANSI colors for each level in tail output
+var levelColors = map[Level]string{
+	LevelDebug: "\x1b[90m", // Grey
+	LevelInfo:  "\x1b[32m", // Green
+	LevelWarn:  "\x1b[33m", // Yellow
+	LevelError: "\x1b[31m", // Red
+}
+
+// tailLog follows the JSON lines log at path like tail -f, pretty-printing each entry to w
+// with color-coded levels, until ctx is done. It waits for the file to appear, and reopens it
+// from the start when it is rotated away or truncated
+func tailLog(ctx context.Context, w io.Writer, path string, color bool) error {
+	var f *os.File
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+	var r *bufio.Reader
+	var partial []byte // Start of a line whose end has not been written yet
+	first := true
+	for ctx.Err() == nil {
+		if f == nil {
+			var err error
+			if f, err = os.Open(path); err != nil {
+				if !os.IsNotExist(err) {
+					return err
+				}
+				f = nil
+				realClock{}.Sleep(ctx, tailPollInterval)
+				continue
+			}
+			r, partial = bufio.NewReader(f), nil
+			if first {
+				// Only the first open skips ahead; a rotated-in file is read from its start
+				if err := printBacklog(w, f, color); err != nil {
+					return err
+				}
+				first = false
+			}
+		}
+
+		line, err := r.ReadBytes('\n')
+		partial = append(partial, line...)
+		if err == nil {
+			printTailLine(w, partial, color)
+			partial = nil
+			continue
+		}
+		if err != io.EOF {
+			return err
+		}
+		if tailReplaced(f, path) {
+			// Drain what was written between the EOF above and the rotation, then switch over
+			for {
+				line, err := r.ReadBytes('\n')
+				partial = append(partial, line...)
+				if err != nil {
+					break
+				}
+				printTailLine(w, partial, color)
+				partial = nil
+			}
+			printTailLine(w, partial, color)
+			f.Close()
+			f = nil
+			continue
+		}
+		realClock{}.Sleep(ctx, tailPollInterval)
+	}
+	return nil
+}
+
+// printBacklog prints the last tailBacklog complete lines of f and leaves f positioned after them
+func printBacklog(w io.Writer, f *os.File, color bool) error {
+	var lines [][]byte
+	var offset int64 // End of the last complete line
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		offset += int64(len(line))
+		lines = append(lines, line)
+		if len(lines) > tailBacklog {
+			lines = lines[1:]
+		}
+	}
+	for _, line := range lines {
+		printTailLine(w, line, color)
+	}
+	// Resume after the last newline, so a line still being written is read in full later
+	_, err := f.Seek(offset, io.SeekStart)
+	return err
+}
+
+// tailReplaced reports whether path no longer refers to the open file f, or f was truncated
+func tailReplaced(f *os.File, path string) bool {
+	current, err := os.Stat(path)
+	if err != nil {
+		return false // Mid-rotation; keep reading the old file until the new one appears
+	}
+	open, err := f.Stat()
+	if err != nil || !os.SameFile(open, current) {
+		return true
+	}
+	pos, err := f.Seek(0, io.SeekCurrent)
+	return err == nil && current.Size() < pos
+}
+
+// printTailLine pretty-prints one log line: time, level, service and message, followed by the
+// remaining fields as key=value pairs. Lines that are not JSON entries are printed as they are
+func printTailLine(w io.Writer, line []byte, color bool) {
+	line = bytes.TrimRight(line, "\r\n")
+	if len(bytes.TrimSpace(line)) == 0 {
+		return
+	}
+	var entry LogEntry
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	if err := dec.Decode(&entry); err != nil || entry.Level == "" {
+		fmt.Fprintf(w, "%s\n", line)
+		return
+	}
+
+	ts := fmt.Sprint(entry.Timestamp)
+	if at, ok := parseEntryTime(entry.Timestamp); ok {
+		ts = at.Local().Format("15:04:05.000")
+	}
+	level := fmt.Sprintf("%-5s", entry.Level)
+	if c, ok := levelColors[entry.Level]; ok && color {
+		level = c + level + "\x1b[0m"
+	}
+
+	var extra []entryField
+	for _, f := range entryFields(entry) {
+		switch f.key {
+		case "timestamp", "level", "severity_number", "service", "message", "hostname":
+		default:
+			extra = append(extra, f)
+		}
+	}
+	fmt.Fprintf(w, "%s %s %-13s %s", ts, level, entry.Service, entry.Message)
+	if len(extra) > 0 {
+		fmt.Fprintf(w, "  %s", formatLogfmtLine(extra))
+	}
+	fmt.Fprintln(w)
+}
+
+// useColor reports whether tail output to f should be colored: only on a terminal, and
+// not when NO_COLOR is set (https://no-color.org)
+func useColor(f *os.File) bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0 && !strings.EqualFold(os.Getenv("TERM"), "dumb")
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// messageTemplates replace the built-in message of entries by level, e.g.
+// "{{.Component}} failed after {{.ResponseTime}}ms" for ERROR; levels without one keep theirs
+var messageTemplates = map[Level]*template.Template{}
+
+// parseMessageTemplates compiles the level-keyed templates in texts, checking each against a
+// sample entry so an unknown field or a syntax error is reported at startup rather than per entry
+func parseMessageTemplates(texts map[string]string) (map[Level]*template.Template, error) {
+	names := make([]string, 0, len(texts))
+	for name := range texts {
+		names = append(names, name)
+	}
+	sort.Strings(names) // Report errors in a stable order
+
+	parsed := map[Level]*template.Template{}
+	for _, name := range names {
+		level, err := parseLevel(name)
+		if err != nil {
+			return nil, fmt.Errorf("message template: %w", err)
+		}
+		t, err := template.New(string(level)).Option("missingkey=error").Parse(texts[name])
+		if err != nil {
+			return nil, fmt.Errorf("message template for %s: %w", level, err)
+		}
+		if err := t.Execute(&strings.Builder{}, LogEntry{Attributes: map[string]string{}}); err != nil {
+			return nil, fmt.Errorf("message template for %s: %w", level, err)
+		}
+		parsed[level] = t
+	}
+	return parsed, nil
+}
+
+// renderMessage returns entry's message from the template for its level, or the built-in
+// message if there is none or it fails on this entry (e.g. indexing a missing attribute)
+func renderMessage(entry LogEntry) string {
+	t, ok := messageTemplates[entry.Level]
+	if !ok {
+		return entry.Message
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, entry); err != nil {
+		return entry.Message
+	}
+	return b.String()
+}